@@ -3,13 +3,25 @@ package main
 import "go-metricscol/internal/models"
 
 type commandLineArguments struct {
-	Address           string          `json:"address,omitempty" env:"ADDRESS"`
-	ReportInterval    models.Duration `json:"report_interval,omitempty" env:"REPORT_INTERVAL"`
-	PollInterval      models.Duration `json:"poll_interval,omitempty" env:"POLL_INTERVAL"`
-	HashKey           string          `json:"hash_key,omitempty" env:"KEY"`
-	RateLimit         int             `json:"rate_limit,omitempty" env:"RATE_LIMIT"`
-	CryptoKeyFilePath string          `json:"crypto_key_file_path,omitempty" env:"CRYPTO_KEY"`
-	JSONConfigPath    string          `env:"CONFIG"`
+	Address             string          `json:"address,omitempty" env:"ADDRESS"`
+	ReportInterval      models.Duration `json:"report_interval,omitempty" env:"REPORT_INTERVAL"`
+	PollInterval        models.Duration `json:"poll_interval,omitempty" env:"POLL_INTERVAL"`
+	HashKey             string          `json:"hash_key,omitempty" env:"KEY"`
+	RateLimit           int             `json:"rate_limit,omitempty" env:"RATE_LIMIT"` // deprecated, ignored
+	CryptoKeyFilePath   string          `json:"crypto_key_file_path,omitempty" env:"CRYPTO_KEY"`
+	Labels              string          `json:"labels,omitempty" env:"LABELS"`
+	QueueFilePath       string          `json:"queue_file,omitempty" env:"QUEUE_FILE"`
+	QueueMaxSize        int64           `json:"queue_max_size,omitempty" env:"QUEUE_MAX_SIZE"`
+	RetryMaxAttempts    int             `json:"retry_max_attempts,omitempty" env:"RETRY_MAX_ATTEMPTS"`
+	RetryInitialBackoff models.Duration `json:"retry_initial_backoff,omitempty" env:"RETRY_INITIAL_BACKOFF"`
+	RetryMaxBackoff     models.Duration `json:"retry_max_backoff,omitempty" env:"RETRY_MAX_BACKOFF"`
+	RetryJitter         float64         `json:"retry_jitter,omitempty" env:"RETRY_JITTER"`
+	TLSCAFile           string          `json:"tls_ca_file,omitempty" env:"TLS_CA"`
+	TLSCertFile         string          `json:"tls_cert_file,omitempty" env:"TLS_CERT"`
+	TLSKeyFile          string          `json:"tls_key_file,omitempty" env:"TLS_KEY"`
+	Token               string          `json:"token,omitempty" env:"TOKEN"`
+	Tenant              string          `json:"tenant,omitempty" env:"TENANT"`
+	JSONConfigPath      string          `env:"CONFIG"`
 }
 
 // Merge writes values of parameter to default same-named values.
@@ -38,6 +50,54 @@ func (c *commandLineArguments) Merge(other commandLineArguments) {
 		c.CryptoKeyFilePath = other.CryptoKeyFilePath
 	}
 
+	if len(c.Labels) == 0 {
+		c.Labels = other.Labels
+	}
+
+	if len(c.QueueFilePath) == 0 {
+		c.QueueFilePath = other.QueueFilePath
+	}
+
+	if c.QueueMaxSize == 0 {
+		c.QueueMaxSize = other.QueueMaxSize
+	}
+
+	if c.RetryMaxAttempts == 0 {
+		c.RetryMaxAttempts = other.RetryMaxAttempts
+	}
+
+	if c.RetryInitialBackoff.Duration == 0 {
+		c.RetryInitialBackoff = other.RetryInitialBackoff
+	}
+
+	if c.RetryMaxBackoff.Duration == 0 {
+		c.RetryMaxBackoff = other.RetryMaxBackoff
+	}
+
+	if c.RetryJitter == 0 {
+		c.RetryJitter = other.RetryJitter
+	}
+
+	if len(c.TLSCAFile) == 0 {
+		c.TLSCAFile = other.TLSCAFile
+	}
+
+	if len(c.TLSCertFile) == 0 {
+		c.TLSCertFile = other.TLSCertFile
+	}
+
+	if len(c.TLSKeyFile) == 0 {
+		c.TLSKeyFile = other.TLSKeyFile
+	}
+
+	if len(c.Token) == 0 {
+		c.Token = other.Token
+	}
+
+	if len(c.Tenant) == 0 {
+		c.Tenant = other.Tenant
+	}
+
 	if len(c.JSONConfigPath) == 0 {
 		c.JSONConfigPath = other.JSONConfigPath
 	}
@@ -84,6 +84,10 @@ func main() {
 				log.Printf("Error while sending metrics to server: %s", err)
 			}
 
+			if err := agentClient.Close(); err != nil {
+				log.Printf("Couldn't close agent: %s", err)
+			}
+
 			log.Print("Agent graceful shutdown \n")
 			os.Exit(0)
 		}
@@ -100,12 +104,26 @@ func init() {
 	flag.Var(&arguments.ReportInterval, "r", "Interval to report metrics")
 	flag.Var(&arguments.PollInterval, "p", "Interval to poll metrics")
 	flag.StringVar(&arguments.HashKey, "k", "", "Key to encrypt metrics")
-	flag.IntVar(&arguments.RateLimit, "l", 1, "Limit the number of requests to the server")
+	flag.IntVar(&arguments.RateLimit, "l", 0, "Deprecated, ignored: metrics are sent by one request at a time")
 	flag.StringVar(&arguments.CryptoKeyFilePath, "crypto-key", "", "Private crypto key for asymmetric encryption")
+	flag.StringVar(&arguments.Labels, "labels", "", "Labels attached to every metric, e.g. host=web1,region=eu")
+	flag.StringVar(&arguments.QueueFilePath, "queue-file", "", "File to queue metrics which couldn't be sent to the server")
+	flag.Int64Var(&arguments.QueueMaxSize, "queue-max-size", agent.DefaultQueueMaxSize, "Maximum size of the queue in bytes, the oldest metrics are dropped when it's exceeded")
+	flag.IntVar(&arguments.RetryMaxAttempts, "retry-max-attempts", agent.DefaultRetryPolicy.MaxAttempts, "Maximum number of attempts to send request to the server")
+	flag.Var(&arguments.RetryInitialBackoff, "retry-initial-backoff", "Delay before the first retry, doubled after every attempt")
+	flag.Var(&arguments.RetryMaxBackoff, "retry-max-backoff", "Maximum delay between retries")
+	flag.Float64Var(&arguments.RetryJitter, "retry-jitter", agent.DefaultRetryPolicy.Jitter, "Fraction of delay between retries which is randomized")
+	flag.StringVar(&arguments.TLSCAFile, "tls-ca", "", "PEM encoded CA bundle to verify the server certificate")
+	flag.StringVar(&arguments.TLSCertFile, "tls-cert", "", "PEM encoded TLS client certificate")
+	flag.StringVar(&arguments.TLSKeyFile, "tls-key", "", "PEM encoded TLS client private key")
+	flag.StringVar(&arguments.Token, "token", "", "Bearer token which authenticates agent on the server")
+	flag.StringVar(&arguments.Tenant, "tenant", "", "Tenant which metrics are sent to")
 	flag.StringVar(&arguments.JSONConfigPath, "c", "", "Path to json config")
 
 	arguments.ReportInterval = models.Duration{Duration: 10 * time.Second}
 	arguments.PollInterval = models.Duration{Duration: 2 * time.Second}
+	arguments.RetryInitialBackoff = models.Duration{Duration: agent.DefaultRetryPolicy.InitialBackoff}
+	arguments.RetryMaxBackoff = models.Duration{Duration: agent.DefaultRetryPolicy.MaxBackoff}
 }
 
 // Parses agent.Config from environment variables or flags.
@@ -137,18 +155,36 @@ func parseConfig() (*agent.Config, error) {
 		return nil, fmt.Errorf("couldn't parse config from env: %s", err)
 	}
 
+	if arguments.RateLimit != 0 {
+		log.Print("Rate limit setting is deprecated and ignored, metrics are sent by one request at a time")
+	}
+
 	config, err := agent.NewConfig(
 		arguments.Address,
 		arguments.ReportInterval,
 		arguments.PollInterval,
 		arguments.HashKey,
-		arguments.RateLimit,
 		arguments.CryptoKeyFilePath,
+		arguments.Labels,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create config: %s", err)
 	}
 
+	config.QueueFilePath = arguments.QueueFilePath
+	config.QueueMaxSize = arguments.QueueMaxSize
+	config.Retry = agent.RetryPolicy{
+		MaxAttempts:    arguments.RetryMaxAttempts,
+		InitialBackoff: arguments.RetryInitialBackoff.Duration,
+		MaxBackoff:     arguments.RetryMaxBackoff.Duration,
+		Jitter:         arguments.RetryJitter,
+	}
+	config.TLSCAFile = arguments.TLSCAFile
+	config.TLSCertFile = arguments.TLSCertFile
+	config.TLSKeyFile = arguments.TLSKeyFile
+	config.Token = arguments.Token
+	config.Tenant = arguments.Tenant
+
 	return config, nil
 }
 
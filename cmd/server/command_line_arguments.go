@@ -1,19 +1,39 @@
 package main
 
 import (
+	"go-metricscol/internal/config"
 	"go-metricscol/internal/models"
 )
 
 type commandLineArguments struct {
-	Address           string          `json:"address,omitempty" env:"ADDRESS"`
-	StoreInterval     models.Duration `json:"store_interval,omitempty" env:"STORE_INTERVAL"`
-	StoreFile         string          `json:"store_file,omitempty" env:"STORE_FILE"`
-	Restore           bool            `json:"restore,omitempty" env:"RESTORE"`
-	HashKey           string          `json:"hash_key,omitempty" env:"KEY"`
-	DatabaseDSN       string          `json:"database_dsn,omitempty" env:"DATABASE_DSN"`
-	CryptoKeyFilePath string          `json:"crypto_key_file_path,omitempty" env:"CRYPTO_KEY"`
-	TrustedSubnet     string          `json:"trusted_subnet,omitempty" env:"TRUSTED_SUBNET"`
-	JSONConfigPath    string          `env:"CONFIG"`
+	Address               string                        `json:"address,omitempty" env:"ADDRESS"`
+	StoreInterval         models.Duration               `json:"store_interval,omitempty" env:"STORE_INTERVAL"`
+	StoreFile             string                        `json:"store_file,omitempty" env:"STORE_FILE"`
+	Restore               bool                          `json:"restore,omitempty" env:"RESTORE"`
+	StoreGenerations      int                           `json:"store_generations,omitempty" env:"STORE_GENERATIONS"`
+	HashKey               string                        `json:"hash_key,omitempty" env:"KEY"`
+	DatabaseDSN           string                        `json:"database_dsn,omitempty" env:"DATABASE_DSN"`
+	CryptoKeyFilePath     string                        `json:"crypto_key_file_path,omitempty" env:"CRYPTO_KEY"`
+	TrustedSubnet         string                        `json:"trusted_subnet,omitempty" env:"TRUSTED_SUBNET"`
+	Retention             models.Retention              `json:"retention,omitempty" env:"RETENTION"`
+	CompactInterval       models.Duration               `json:"compact_interval,omitempty" env:"COMPACT_INTERVAL"`
+	GRPCAddress           string                        `json:"grpc_address,omitempty" env:"GRPC_ADDRESS"`
+	StatsDAddress         string                        `json:"statsd_address,omitempty" env:"STATSD_ADDRESS"`
+	StatsDFlushInterval   models.Duration               `json:"statsd_flush_interval,omitempty" env:"STATSD_FLUSH_INTERVAL"`
+	TLSCertFile           string                        `json:"tls_cert_file,omitempty" env:"TLS_CERT"`
+	TLSKeyFile            string                        `json:"tls_key_file,omitempty" env:"TLS_KEY"`
+	TLSClientCAFile       string                        `json:"tls_client_ca_file,omitempty" env:"TLS_CLIENT_CA"`
+	ReplayWindow          models.Duration               `json:"replay_window,omitempty" env:"REPLAY_WINDOW"`
+	NonceCacheSize        int                           `json:"nonce_cache_size,omitempty" env:"NONCE_CACHE_SIZE"`
+	AuthTokensFile        string                        `json:"auth_tokens_file,omitempty" env:"AUTH_TOKENS_FILE"`
+	AuthTokensFromDB      bool                          `json:"auth_tokens_db,omitempty" env:"AUTH_TOKENS_DB"`
+	MaxSeries             int                           `json:"max_series,omitempty" env:"MAX_SERIES"`
+	MaxNewSeriesPerMinute int                           `json:"max_new_series_per_minute,omitempty" env:"MAX_NEW_SERIES_PER_MINUTE"`
+	TenantMaxSeries       int                           `json:"tenant_max_series,omitempty" env:"TENANT_MAX_SERIES"`
+	TenantRateLimit       float64                       `json:"tenant_rate_limit,omitempty" env:"TENANT_RATE_LIMIT"`
+	TenantFromHeader      bool                          `json:"tenant_from_header,omitempty" env:"TENANT_FROM_HEADER"`
+	TenantQuotas          map[string]config.TenantQuota `json:"tenant_quotas,omitempty"`
+	JSONConfigPath        string                        `env:"CONFIG"`
 }
 
 // Merge writes values of parameter to default same-named values.
@@ -53,4 +73,80 @@ func (c *commandLineArguments) Merge(other commandLineArguments) {
 	if len(c.TrustedSubnet) == 0 {
 		c.TrustedSubnet = other.TrustedSubnet
 	}
+
+	if c.StoreGenerations == 0 {
+		c.StoreGenerations = other.StoreGenerations
+	}
+
+	if len(c.Retention) == 0 {
+		c.Retention = other.Retention
+	}
+
+	if c.CompactInterval.Duration == 0 {
+		c.CompactInterval = other.CompactInterval
+	}
+
+	if len(c.GRPCAddress) == 0 {
+		c.GRPCAddress = other.GRPCAddress
+	}
+
+	if len(c.StatsDAddress) == 0 {
+		c.StatsDAddress = other.StatsDAddress
+	}
+
+	if c.StatsDFlushInterval.Duration == 0 {
+		c.StatsDFlushInterval = other.StatsDFlushInterval
+	}
+
+	if len(c.TLSCertFile) == 0 {
+		c.TLSCertFile = other.TLSCertFile
+	}
+
+	if len(c.TLSKeyFile) == 0 {
+		c.TLSKeyFile = other.TLSKeyFile
+	}
+
+	if len(c.TLSClientCAFile) == 0 {
+		c.TLSClientCAFile = other.TLSClientCAFile
+	}
+
+	if c.ReplayWindow.Duration == 0 {
+		c.ReplayWindow = other.ReplayWindow
+	}
+
+	if c.NonceCacheSize == 0 {
+		c.NonceCacheSize = other.NonceCacheSize
+	}
+
+	if len(c.AuthTokensFile) == 0 {
+		c.AuthTokensFile = other.AuthTokensFile
+	}
+
+	if !c.AuthTokensFromDB {
+		c.AuthTokensFromDB = other.AuthTokensFromDB
+	}
+
+	if c.MaxSeries == 0 {
+		c.MaxSeries = other.MaxSeries
+	}
+
+	if c.MaxNewSeriesPerMinute == 0 {
+		c.MaxNewSeriesPerMinute = other.MaxNewSeriesPerMinute
+	}
+
+	if c.TenantMaxSeries == 0 {
+		c.TenantMaxSeries = other.TenantMaxSeries
+	}
+
+	if !c.TenantFromHeader {
+		c.TenantFromHeader = other.TenantFromHeader
+	}
+
+	if c.TenantRateLimit == 0 {
+		c.TenantRateLimit = other.TenantRateLimit
+	}
+
+	if len(c.TenantQuotas) == 0 {
+		c.TenantQuotas = other.TenantQuotas
+	}
 }
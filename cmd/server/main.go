@@ -16,6 +16,7 @@ import (
 
 	"github.com/caarlos0/env/v9"
 
+	"go-metricscol/internal/auth"
 	"go-metricscol/internal/config"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository"
@@ -44,20 +45,44 @@ func main() {
 
 	var repo repository.Repository
 	if len(cfg.DatabaseDSN) > 0 {
-		repo, err = postgres.New(cfg.DatabaseDSN)
+		db, err := postgres.New(cfg.DatabaseDSN)
 		if err != nil {
 			log.Fatalf("couldn't create new postgres db: %s", err)
 		}
+		db.Instrument(cfg.Instruments())
+		repo = db
 	} else {
-		repo = memory.NewMemStorage()
+		storage := memory.NewMemStorage()
+		storage.KeepGenerations(cfg.StoreGenerations)
+		repo = storage
 	}
 
-	createdBackend, err := createBackend(backends.HTTPType, repo, cfg)
+	cfg.Tokens, err = createTokenStore(cfg, repo)
 	if err != nil {
-		log.Fatalf("couldn't create backend with error: %s", err)
+		log.Fatalf("couldn't create token store with error: %s", err)
 	}
 
-	s := server.NewServer(cfg, repo, createdBackend)
+	backendTypes := []backends.BackendType{backends.HTTPType}
+	if len(cfg.GRPCAddress) != 0 {
+		backendTypes = append(backendTypes, backends.GRPCType)
+		log.Printf("Starting grpc server on %s", cfg.GRPCAddress)
+	}
+	if len(cfg.StatsDAddress) != 0 {
+		backendTypes = append(backendTypes, backends.StatsDType)
+		log.Printf("Starting statsd listener on %s", cfg.StatsDAddress)
+	}
+
+	createdBackends := make([]backends.Backend, 0, len(backendTypes))
+	for _, backendType := range backendTypes {
+		createdBackend, err := createBackend(backendType, repo, cfg)
+		if err != nil {
+			log.Fatalf("couldn't create backend with error: %s", err)
+		}
+
+		createdBackends = append(createdBackends, createdBackend)
+	}
+
+	s := server.NewServer(cfg, repo, createdBackends...)
 
 	serverContext, serverContextCancel := context.WithCancel(context.Background())
 	if err != nil {
@@ -92,7 +117,7 @@ func main() {
 func createBackend(backendType backends.BackendType, repository repository.Repository, cfg *config.ServerConfig) (backends.Backend, error) {
 	switch backendType {
 	case backends.GRPCType:
-		listen, err := net.Listen("tcp", cfg.Address)
+		listen, err := net.Listen("tcp", cfg.GRPCAddress)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't listen: %s", err)
 		}
@@ -100,11 +125,34 @@ func createBackend(backendType backends.BackendType, repository repository.Repos
 		return backends.NewGrpc(repository, cfg, listen)
 	case backends.HTTPType:
 		return backends.NewHTTP(repository, cfg)
+	case backends.StatsDType:
+		conn, err := net.ListenPacket("udp", cfg.StatsDAddress)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't listen: %s", err)
+		}
+
+		return backends.NewStatsD(repository, cfg, conn)
 	default:
 		return nil, fmt.Errorf("unknown backend type id: %d", backendType)
 	}
 }
 
+// createTokenStore returns store of agent tokens configured in cfg or nil if authentication is disabled.
+func createTokenStore(cfg *config.ServerConfig, repository repository.Repository) (auth.TokenStore, error) {
+	switch {
+	case len(cfg.AuthTokensFile) != 0:
+		return auth.NewFileTokenStore(cfg.AuthTokensFile)
+	case cfg.AuthTokensFromDB:
+		db, ok := repository.(*postgres.DB)
+		if !ok {
+			return nil, fmt.Errorf("reading tokens from database requires database DSN")
+		}
+		return db, nil
+	default:
+		return nil, nil
+	}
+}
+
 var jsonParsedArguments commandLineArguments
 var arguments commandLineArguments
 
@@ -114,13 +162,38 @@ func init() {
 	flag.Var(&arguments.StoreInterval, "i", "Interval to store metrics")
 	flag.StringVar(&arguments.StoreFile, "f", "/tmp/devops-metrics-db.json", "File to store metrics")
 	flag.BoolVar(&arguments.Restore, "r", true, "Restore metrics from file")
+	flag.IntVar(&arguments.StoreGenerations, "store-generations", config.DefaultStoreGenerations, "Number of previous files kept to restore metrics")
 	flag.StringVar(&arguments.HashKey, "k", "", "Key to encrypt metrics")
 	flag.StringVar(&arguments.DatabaseDSN, "d", "", "Database DSN")
 	flag.StringVar(&arguments.CryptoKeyFilePath, "crypto-key", "", "Private crypto key for asymmetric encryption")
 	flag.StringVar(&arguments.JSONConfigPath, "c", "", "Path to json config")
 	flag.StringVar(&arguments.TrustedSubnet, "t", "", "Trusted subnet")
+	flag.Var(&arguments.Retention, "retention", "Retention windows of metrics history in format resolution:period")
+	flag.Var(&arguments.CompactInterval, "compact-interval", "Interval to downsample and delete expired metrics history")
+	flag.StringVar(&arguments.GRPCAddress, "grpc-address", "", "Address to listen by grpc server")
+	flag.StringVar(&arguments.StatsDAddress, "statsd-address", "", "UDP address of StatsD listener")
+	flag.Var(&arguments.StatsDFlushInterval, "statsd-flush-interval", "Interval to flush aggregated StatsD metrics")
+	flag.StringVar(&arguments.TLSCertFile, "tls-cert", "", "PEM encoded TLS certificate of the server")
+	flag.StringVar(&arguments.TLSKeyFile, "tls-key", "", "PEM encoded TLS private key of the server")
+	flag.StringVar(&arguments.TLSClientCAFile, "tls-client-ca", "", "PEM encoded CA bundle to verify client certificates")
+	flag.Var(&arguments.ReplayWindow, "replay-window", "Maximum allowed clock skew of signed metrics")
+	flag.IntVar(&arguments.NonceCacheSize, "nonce-cache-size", config.DefaultNonceCacheSize, "Number of the latest nonces remembered to reject replayed metrics")
+	flag.StringVar(&arguments.AuthTokensFile, "auth-tokens-file", "", "File with bearer tokens of agents")
+	flag.BoolVar(&arguments.AuthTokensFromDB, "auth-tokens-db", false, "Read bearer tokens of agents from database")
+	flag.IntVar(&arguments.MaxSeries, "max-series", 0, "Maximum number of series of all tenants")
+	flag.IntVar(&arguments.MaxNewSeriesPerMinute, "max-new-series-per-minute", 0, "Maximum number of series created in a minute")
+	flag.IntVar(&arguments.TenantMaxSeries, "tenant-max-series", 0, "Maximum number of series of every tenant")
+	flag.Float64Var(&arguments.TenantRateLimit, "tenant-rate-limit", 0, "Maximum number of requests per second of every tenant")
+	flag.BoolVar(&arguments.TenantFromHeader, "tenant-from-header", false, "Allow agents not bound to a tenant to select tenant with header")
 
 	arguments.StoreInterval = models.Duration{Duration: 300 * time.Second}
+	arguments.Retention = models.Retention{
+		{Period: 24 * time.Hour},
+		{Resolution: time.Minute, Period: 30 * 24 * time.Hour},
+		{Resolution: time.Hour, Period: 365 * 24 * time.Hour},
+	}
+	arguments.CompactInterval = models.Duration{Duration: time.Minute}
+	arguments.StatsDFlushInterval = models.Duration{Duration: 10 * time.Second}
 }
 
 // Parses server.ServerConfig from environment variables or flags.
@@ -146,6 +219,7 @@ func parseConfig() (*config.ServerConfig, error) {
 	opts := env.Options{
 		FuncMap: map[reflect.Type]env.ParserFunc{
 			reflect.TypeOf(arguments.StoreInterval): models.ParseDurationFromEnv,
+			reflect.TypeOf(arguments.Retention):     models.ParseRetentionFromEnv,
 		},
 	}
 	if err := env.ParseWithOptions(&arguments, opts); err != nil {
@@ -166,6 +240,29 @@ func parseConfig() (*config.ServerConfig, error) {
 		return nil, fmt.Errorf("couldn't create config: %s", err)
 	}
 
+	cfg.StoreGenerations = arguments.StoreGenerations
+	cfg.Retention = arguments.Retention
+	cfg.CompactInterval = arguments.CompactInterval.Duration
+	cfg.GRPCAddress = arguments.GRPCAddress
+	cfg.StatsDAddress = arguments.StatsDAddress
+	cfg.StatsDFlushInterval = arguments.StatsDFlushInterval.Duration
+	cfg.TLSCertFile = arguments.TLSCertFile
+	cfg.TLSKeyFile = arguments.TLSKeyFile
+	cfg.TLSClientCAFile = arguments.TLSClientCAFile
+	cfg.ReplayWindow = arguments.ReplayWindow.Duration
+	cfg.NonceCacheSize = arguments.NonceCacheSize
+	cfg.AuthTokensFile = arguments.AuthTokensFile
+	cfg.AuthTokensFromDB = arguments.AuthTokensFromDB
+	cfg.MaxSeries = arguments.MaxSeries
+	cfg.MaxNewSeriesPerMinute = arguments.MaxNewSeriesPerMinute
+	cfg.TenantQuota = config.TenantQuota{MaxSeries: arguments.TenantMaxSeries, RateLimit: arguments.TenantRateLimit}
+	cfg.TenantQuotas = arguments.TenantQuotas
+	cfg.TenantFromHeader = arguments.TenantFromHeader
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
 	return cfg, nil
 }
 
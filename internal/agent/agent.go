@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"errors"
 	"fmt"
 	mathRand "math/rand"
 	"runtime"
@@ -8,7 +9,6 @@ import (
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
-	"golang.org/x/sync/errgroup"
 
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository/memory"
@@ -17,6 +17,7 @@ import (
 type Agent struct {
 	cfg     *Config
 	backend Backend
+	queue   *Queue
 }
 
 func createBackendBasedOnType(cfg *Config, backendType BackendType) (Backend, error) {
@@ -24,7 +25,7 @@ func createBackendBasedOnType(cfg *Config, backendType BackendType) (Backend, er
 	case GRPC:
 		return NewGrpc(cfg)
 	case HTTP:
-		return NewHTTPBackend(cfg), nil
+		return NewHTTPBackend(cfg)
 	default:
 		return nil, fmt.Errorf("unknown backend type id: %d", backendType)
 	}
@@ -36,42 +37,28 @@ func NewAgent(cfg *Config, backendType BackendType) (*Agent, error) {
 		return nil, fmt.Errorf("couldn't create backend: %s", err)
 	}
 
-	return &Agent{cfg: cfg, backend: backend}, nil
+	queue, err := OpenQueue(cfg.QueueFilePath, cfg.QueueMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open queue: %s", err)
+	}
+
+	return &Agent{cfg: cfg, backend: backend, queue: queue}, nil
 }
 
 func (agent Agent) Close() error {
-	return agent.backend.Close()
+	return errors.Join(agent.backend.Close(), agent.queue.Close())
 }
 
 // SendMetricsToServer sends metrics stored is memory.Metrics to the address given in agent.Config.
-// Rate limit defined in config is not exceeded.
+// Current metrics are appended to the queue first, then all queued batches are sent in order,
+// so batches which couldn't be sent before are replayed once the server is reachable.
+// Batches are sent one by one, so the agent has at most one request to the server in flight.
 func (agent Agent) SendMetricsToServer(m *memory.Metrics) error {
-	jobCh := make(chan bool)
-	g := errgroup.Group{}
-
-	for i := 0; i < agent.cfg.RateLimit; i++ {
-		g.Go(func() error {
-			for range jobCh {
-				if agent.cfg.CryptoKey == nil {
-					return agent.backend.SendMetricsAllTogether(m)
-				}
-				if err := agent.backend.SendMetricsByOne(m); err != nil {
-					return fmt.Errorf("couldn't send metrics to server: %s", err)
-				}
-			}
-			return nil
-		})
+	if err := agent.queue.Push(m.GetAllAndResetPollCount()); err != nil {
+		return fmt.Errorf("couldn't queue metrics: %s", err)
 	}
 
-	jobCh <- true
-	close(jobCh)
-
-	if err := g.Wait(); err != nil {
-		return err
-	}
-
-	m.ResetPollCount()
-	return nil
+	return agent.queue.Drain(agent.backend.SendMetricsAllTogether)
 }
 
 // UpdateMetrics gets all metrics from runtime.MemStats and writes them to memory.Metrics.
@@ -1,6 +1,6 @@
 package agent
 
-import "go-metricscol/internal/repository/memory"
+import "go-metricscol/internal/models"
 
 type BackendType int
 
@@ -10,7 +10,6 @@ const (
 )
 
 type Backend interface {
-	SendMetricsByOne(m *memory.Metrics) error
-	SendMetricsAllTogether(m *memory.Metrics) error
+	SendMetricsAllTogether(metrics []models.Metric) error
 	Close() error
 }
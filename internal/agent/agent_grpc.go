@@ -3,15 +3,21 @@ package agent
 import (
 	"context"
 	"fmt"
+	"log"
+	"net"
+	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
 
+	"go-metricscol/internal/envelope"
+	"go-metricscol/internal/models"
 	pb "go-metricscol/internal/proto"
-	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/tenant"
 )
 
 type Grpc struct {
@@ -21,7 +27,17 @@ type Grpc struct {
 }
 
 func NewGrpc(cfg *Config) (*Grpc, error) {
-	conn, err := grpc.Dial(cfg.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.Dial(cfg.Address, grpc.WithTransportCredentials(transportCredentials))
 	if err != nil {
 		return nil, err
 	}
@@ -29,63 +45,96 @@ func NewGrpc(cfg *Config) (*Grpc, error) {
 	return &Grpc{cfg: cfg, conn: conn, client: pb.NewMetricsClient(conn)}, nil
 }
 
-func (agent Grpc) SendMetricsByOne(m *memory.Metrics) error {
-	for _, value := range m.Collection {
-		metric := pb.Metric{
-			Name:  value.Name,
-			Type:  pb.MetricType(value.MType.IntGrpc()),
-			Value: value.StringValue(),
-			Hash:  value.HashValue(agent.cfg.HashKey),
+func (agent Grpc) SendMetricsAllTogether(metrics []models.Metric) error {
+	ip, err := getOutboundIP()
+	if err != nil {
+		return fmt.Errorf("couldn't get outbound ip: %s", err.Error())
+	}
+	ipCtx := agent.outgoingContext(ip)
+
+	// Request is signed before every attempt, so retries are not rejected as replayed.
+	return agent.cfg.Retry.Do(func() error {
+		now := time.Now()
+		processed := make([]*pb.Metric, 0, len(metrics))
+		for _, value := range metrics {
+			value.Labels = agent.cfg.Labels
+			if err := value.Sign(agent.cfg.HashKey, now); err != nil {
+				return fmt.Errorf("couldn't sign metric: %s", err)
+			}
+			processed = append(processed, pb.NewMetric(value, agent.cfg.HashKey))
 		}
 
-		ip, err := getOutboundIP()
-		if err != nil {
-			return fmt.Errorf("couldn't get outbound ip: %s", err.Error())
+		request := &pb.UpdatesRequest{Metric: processed, Partial: true}
+		if agent.cfg.CryptoKey != nil {
+			encrypted, err := agent.encrypt(request)
+			if err != nil {
+				return err
+			}
+			request = &pb.UpdatesRequest{Encrypted: encrypted}
 		}
-		ipCtx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("X-Real-IP", ip.String()))
 
-		_, err = agent.client.UpdateMetric(ipCtx, &pb.UpdateRequest{Metric: &metric})
+		response, err := agent.client.UpdatesMetric(ipCtx, request)
 		if err != nil {
-			if e, ok := status.FromError(err); ok {
-				if e.Code() != codes.OK {
-					return fmt.Errorf("coudln't send metrics, status code: %d, response: %s", e.Code(), e.Message())
-				}
-			}
+			return statusError(err)
 		}
-	}
-
-	return nil
-}
 
-func (agent Grpc) SendMetricsAllTogether(m *memory.Metrics) error {
-	metrics := make([]*pb.Metric, 0, len(m.Collection))
-	for _, value := range m.Collection {
-		metric := pb.Metric{
-			Name:  value.Name,
-			Type:  pb.MetricType(value.MType.IntGrpc()),
-			Value: value.StringValue(),
-			Hash:  value.HashValue(agent.cfg.HashKey),
+		// Invalid metrics are skipped by server, sending them again won't help.
+		for _, updateError := range response.GetErrors() {
+			log.Printf("Server skipped metric %s with error: %s", updateError.GetName(), updateError.GetMessage())
 		}
 
-		metrics = append(metrics, &metric)
+		return nil
+	})
+}
+
+// outgoingContext returns context with metadata sent with every request: address of the agent, its bearer token and tenant.
+func (agent Grpc) outgoingContext(ip net.IP) context.Context {
+	md := metadata.Pairs("X-Real-IP", ip.String())
+	if len(agent.cfg.Token) != 0 {
+		md.Set("authorization", "Bearer "+agent.cfg.Token)
+	}
+	if len(agent.cfg.Tenant) != 0 {
+		md.Set(tenant.MetadataKey, agent.cfg.Tenant)
 	}
 
-	ip, err := getOutboundIP()
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
+
+// encrypt serializes request and encrypts it with envelope.Encrypt, so it can be sent in encrypted field of request.
+func (agent Grpc) encrypt(request protobuf.Message) ([]byte, error) {
+	payload, err := protobuf.Marshal(request)
 	if err != nil {
-		return fmt.Errorf("couldn't get outbound ip: %s", err.Error())
+		return nil, fmt.Errorf("couldn't marshal request: %s", err)
 	}
-	ipCtx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("X-Real-IP", ip.String()))
 
-	_, err = agent.client.UpdatesMetric(ipCtx, &pb.UpdatesRequest{Metric: metrics})
+	encrypted, err := envelope.Encrypt(agent.cfg.CryptoKey, payload)
 	if err != nil {
-		if e, ok := status.FromError(err); ok {
-			if e.Code() != codes.OK {
-				return fmt.Errorf("coudln't send metrics, status code: %d, response: %s", e.Code(), e.Message())
-			}
-		}
+		return nil, fmt.Errorf("couldn't encrypt metrics: %s", err)
+	}
+
+	return encrypted, nil
+}
+
+// statusError converts error returned by grpc call to error with status code, which is marked retryable or rejected if needed.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	e, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	result := fmt.Errorf("coudln't send metrics, status code: %d, response: %s", e.Code(), e.Message())
+	if retryableGrpcCode(e.Code()) {
+		return retryableError{err: result}
+	}
+	if rejectedGrpcCode(e.Code()) {
+		return rejectedError{err: result}
 	}
 
-	return nil
+	return result
 }
 
 func (agent Grpc) Close() error {
@@ -3,157 +3,191 @@ package agent
 import (
 	"bytes"
 	"compress/gzip"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"time"
 
+	"go-metricscol/internal/envelope"
 	"go-metricscol/internal/models"
-	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/tenant"
 )
 
 type HTTPBackend struct {
-	cfg *Config
+	cfg    *Config
+	client *http.Client
+	scheme string
 }
 
-func NewHTTPBackend(cfg *Config) *HTTPBackend {
-	return &HTTPBackend{cfg: cfg}
+// NewHTTPBackend creates HTTPBackend, which uses https if TLS is configured in Config.
+func NewHTTPBackend(cfg *Config) (*HTTPBackend, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil {
+		return &HTTPBackend{cfg: cfg, client: http.DefaultClient, scheme: "http"}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &HTTPBackend{cfg: cfg, client: &http.Client{Transport: transport}, scheme: "https"}, nil
 }
 
 func (h HTTPBackend) Close() error {
+	h.client.CloseIdleConnections()
 	return nil
 }
 
-func (h HTTPBackend) SendMetricsByOne(m *memory.Metrics) error {
+func (h HTTPBackend) SendMetricsAllTogether(metrics []models.Metric) error {
 	postURL := url.URL{
-		Scheme: "http",
+		Scheme: h.scheme,
 		Host:   h.cfg.Address,
-		Path:   "/update/",
+		Path:   "/updates/",
+		// Invalid metrics of the batch don't prevent updating valid ones.
+		RawQuery: "partial=true",
 	}
 
-	for _, value := range m.Collection {
-		value.Hash = value.HashValue(h.cfg.HashKey)
+	processed := make([]models.Metric, 0, len(metrics))
+	for _, value := range metrics {
+		value.Labels = h.cfg.Labels
+		processed = append(processed, value)
+	}
 
-		processedMetrics, err := json.Marshal(value)
-		if err != nil {
-			return errors.New("couldn't marshal metric")
+	return h.post(postURL, func() ([]byte, error) {
+		now := time.Now()
+		for i := range processed {
+			if err := processed[i].Sign(h.cfg.HashKey, now); err != nil {
+				return nil, fmt.Errorf("couldn't sign metric: %s", err)
+			}
 		}
-		processedMetrics, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, h.cfg.CryptoKey, processedMetrics, nil)
+
+		processedMetrics, err := json.Marshal(processed)
 		if err != nil {
-			return fmt.Errorf("couldn't encrypt metric: %s", err)
+			return nil, errors.New("couldn't marshal metrics")
 		}
 
-		gzipMetrics := bytes.NewBuffer([]byte{})
-		w := gzip.NewWriter(gzipMetrics)
-		_, err = w.Write(processedMetrics)
+		return processedMetrics, nil
+	})
+}
+
+// post sends body returned by marshal to the server, request is repeated according to retry policy defined in config.
+// Body is marshaled again before every attempt, so every attempt is signed with new timestamp and nonce.
+// If hash key is set in config, the whole body is signed with models.BodyHashHeader.
+func (h HTTPBackend) post(postURL url.URL, marshal func() ([]byte, error)) error {
+	ip, err := getOutboundIP()
+	if err != nil {
+		return fmt.Errorf("couldn't get outbound ip: %s", err.Error())
+	}
+
+	return h.cfg.Retry.Do(func() error {
+		body, err := marshal()
 		if err != nil {
-			return fmt.Errorf("couldn't gzip metric with error: %s", err)
+			return err
 		}
 
-		err = w.Close()
+		bodyHash := models.HashBody(h.cfg.HashKey, body)
+
+		body, err = h.encode(body)
 		if err != nil {
-			return fmt.Errorf("couldn't close gzip writer with error: %s", err)
+			return err
 		}
 
-		request, err := http.NewRequest(http.MethodPost, postURL.String(), gzipMetrics)
+		request, err := http.NewRequest(http.MethodPost, postURL.String(), bytes.NewReader(body))
 		if err != nil {
 			return fmt.Errorf("couldn't create request with error: %s", err)
 		}
 
 		request.Header.Set("Content-Encoding", "gzip")
+		request.Header.Set("X-Real-IP", ip.String())
+		if len(bodyHash) != 0 {
+			request.Header.Set(models.BodyHashHeader, bodyHash)
+		}
+		if len(h.cfg.Token) != 0 {
+			request.Header.Set("Authorization", "Bearer "+h.cfg.Token)
+		}
+		if len(h.cfg.Tenant) != 0 {
+			request.Header.Set(tenant.Header, h.cfg.Tenant)
+		}
 
-		ip, err := getOutboundIP()
+		resp, err := h.client.Do(request)
 		if err != nil {
-			return fmt.Errorf("couldn't get outbound ip: %s", err.Error())
+			return retryableError{err: fmt.Errorf("couldn't post url %s: %s", postURL.String(), err)}
 		}
+		defer resp.Body.Close()
 
-		request.Header.Set("X-Real-IP", ip.String())
-
-		resp, err := http.DefaultClient.Do(request)
-		if err != nil {
-			return fmt.Errorf("couldn't post url %s", postURL.String())
+		// Invalid metrics are skipped by server, sending them again won't help.
+		if resp.StatusCode == http.StatusMultiStatus {
+			logSkippedMetrics(resp.Body)
+			return nil
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			body, err := io.ReadAll(resp.Body)
+			respBody, err := io.ReadAll(resp.Body)
 			if err != nil {
 				return err
 			}
-			return fmt.Errorf("coudln't send metrics, status code: %d, response: %s", resp.StatusCode, body)
-		}
 
-		if err := resp.Body.Close(); err != nil {
-			return errors.New("couldn't close response body")
+			err = fmt.Errorf("coudln't send metrics, status code: %d, response: %s", resp.StatusCode, respBody)
+			if retryableHTTPStatus(resp.StatusCode) {
+				return retryableError{err: err}
+			}
+			if rejectedHTTPStatus(resp.StatusCode) {
+				return rejectedError{err: err}
+			}
+			return err
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
-func (h HTTPBackend) SendMetricsAllTogether(m *memory.Metrics) error {
-	postURL := url.URL{
-		Scheme: "http",
-		Host:   h.cfg.Address,
-		Path:   "/updates/",
+// logSkippedMetrics logs errors of metrics skipped by server from partial update response.
+func logSkippedMetrics(body io.Reader) {
+	var result struct {
+		Errors []struct {
+			Name   string `json:"name"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
 	}
 
-	metrics := make([]models.Metric, 0, len(m.Collection))
-	for _, value := range m.Collection {
-		value.Hash = value.HashValue(h.cfg.HashKey)
-		metrics = append(metrics, value)
+	if err := json.NewDecoder(body).Decode(&result); err != nil {
+		log.Printf("Server skipped some metrics, couldn't decode response with error: %s", err)
+		return
 	}
 
-	processedMetrics, err := json.Marshal(metrics)
-	if err != nil {
-		return errors.New("couldn't marshal metrics")
-	}
-
-	gzipMetrics := bytes.NewBuffer([]byte{})
-	w := gzip.NewWriter(gzipMetrics)
-	_, err = w.Write(processedMetrics)
-	if err != nil {
-		return fmt.Errorf("couldn't gzip metrics with error: %s", err)
-	}
-
-	err = w.Close()
-	if err != nil {
-		return fmt.Errorf("couldn't close gzip writer with error: %s", err)
+	for _, skipped := range result.Errors {
+		log.Printf("Server skipped metric %s with error: %s", skipped.Name, skipped.Detail)
 	}
+}
 
-	request, err := http.NewRequest(http.MethodPost, postURL.String(), gzipMetrics)
-	if err != nil {
-		return fmt.Errorf("couldn't create request with error: %s", err)
+// encode gzips body. If crypto key is set in config, body is encrypted with envelope.Encrypt before compression.
+func (h HTTPBackend) encode(body []byte) ([]byte, error) {
+	if h.cfg.CryptoKey != nil {
+		encrypted, err := envelope.Encrypt(h.cfg.CryptoKey, body)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't encrypt metrics: %s", err)
+		}
+		body = encrypted
 	}
-	request.Header.Set("Content-Encoding", "gzip")
 
-	ip, err := getOutboundIP()
+	gzipBody := bytes.NewBuffer([]byte{})
+	w := gzip.NewWriter(gzipBody)
+	_, err := w.Write(body)
 	if err != nil {
-		return fmt.Errorf("couldn't get outbound ip: %s", err.Error())
+		return nil, fmt.Errorf("couldn't gzip metrics with error: %s", err)
 	}
 
-	request.Header.Set("X-Real-IP", ip.String())
-
-	resp, err := http.DefaultClient.Do(request)
+	err = w.Close()
 	if err != nil {
-		return fmt.Errorf("couldn't post url %s", postURL.String())
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("coudln't send metrics, status code: %d, response: %s", resp.StatusCode, body)
-	}
-
-	if err := resp.Body.Close(); err != nil {
-		return errors.New("couldn't close response body")
+		return nil, fmt.Errorf("couldn't close gzip writer with error: %s", err)
 	}
 
-	return err
+	return gzipBody.Bytes(), nil
 }
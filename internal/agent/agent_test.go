@@ -1,9 +1,11 @@
 package agent
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository/memory"
@@ -66,3 +68,47 @@ func TestUpdatePollCount(t *testing.T) {
 	assert.EqualValues(t, nil, err)
 	assert.Equal(t, pollCount.StringValue(), "5")
 }
+
+// fakeBackend records sent batches and fails while err is set.
+type fakeBackend struct {
+	err     error
+	batches [][]models.Metric
+}
+
+func (f *fakeBackend) SendMetricsAllTogether(metrics []models.Metric) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.batches = append(f.batches, metrics)
+	return nil
+}
+
+func (f *fakeBackend) Close() error {
+	return nil
+}
+
+func TestAgent_SendMetricsToServerReplaysQueue(t *testing.T) {
+	queue, err := OpenQueue("", 0)
+	require.NoError(t, err)
+
+	backend := &fakeBackend{err: errors.New("connection refused")}
+	agent := Agent{cfg: &Config{}, backend: backend, queue: queue}
+
+	metrics := memory.NewMetrics()
+	require.NoError(t, metrics.Update("PollCount", models.Counter, 2))
+	assert.Error(t, agent.SendMetricsToServer(&metrics))
+
+	require.NoError(t, metrics.Update("PollCount", models.Counter, 3))
+	assert.Error(t, agent.SendMetricsToServer(&metrics))
+
+	backend.err = nil
+	require.NoError(t, agent.SendMetricsToServer(&metrics))
+
+	var sent []int64
+	for _, batch := range backend.batches {
+		require.Len(t, batch, 1)
+		sent = append(sent, *batch[0].Delta)
+	}
+	assert.Equal(t, []int64{2, 3, 0}, sent)
+}
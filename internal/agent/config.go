@@ -2,17 +2,20 @@ package agent
 
 import (
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"os"
 	"time"
 
+	"go-metricscol/internal/config"
 	"go-metricscol/internal/models"
 )
 
 var (
-	DefaultAddress = "127.0.0.1:8080"
+	DefaultAddress      = "127.0.0.1:8080"
+	DefaultQueueMaxSize = int64(10 << 20)
 )
 
 // Config describes parameters required for Agent work.
@@ -21,8 +24,27 @@ type Config struct {
 	ReportInterval time.Duration
 	PollInterval   time.Duration
 	HashKey        string
-	RateLimit      int
 	CryptoKey      *rsa.PublicKey
+	Labels         models.Labels
+
+	// QueueFilePath is a segment file of the queue of unsent batches, batches are kept only in memory if it is empty.
+	QueueFilePath string
+	// QueueMaxSize is maximum size of the queue in bytes, the oldest batches are dropped when it's exceeded.
+	QueueMaxSize int64
+
+	// Retry describes how failed requests to the server are repeated.
+	Retry RetryPolicy
+
+	// TLSCAFile is PEM encoded bundle of CA certificates used to verify the server, system CAs are used if it is empty.
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are PEM encoded client certificate and private key presented to the server (mutual TLS).
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Token is bearer token which authenticates agent on the server.
+	Token string
+	// Tenant is tenant which metrics are sent to, server uses default tenant if it is empty.
+	Tenant string
 }
 
 func rsaPublicKeyParser(input string) (*rsa.PublicKey, error) {
@@ -49,20 +71,55 @@ func NewConfig(
 	reportInterval models.Duration,
 	pollInterval models.Duration,
 	hashKey string,
-	rateLimit int,
 	cryptoKeyFilePath string,
+	labels string,
 ) (*Config, error) {
 	cryptoKey, err := rsaPublicKeyParser(cryptoKeyFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create config: %s", err)
 	}
 
+	parsedLabels, err := models.ParseLabels(labels)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse labels: %s", err)
+	}
+
 	return &Config{
 		Address:        address,
 		ReportInterval: reportInterval.Duration,
 		PollInterval:   pollInterval.Duration,
 		HashKey:        hashKey,
-		RateLimit:      rateLimit,
 		CryptoKey:      cryptoKey,
+		Labels:         parsedLabels,
+		QueueMaxSize:   DefaultQueueMaxSize,
+		Retry:          DefaultRetryPolicy,
 	}, nil
 }
+
+// TLSConfig returns TLS configuration of connections to the server or nil if TLS is disabled.
+// TLS is enabled if CA bundle or client certificate is set.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if len(c.TLSCAFile) == 0 && len(c.TLSCertFile) == 0 && len(c.TLSKeyFile) == 0 {
+		return nil, nil
+	}
+
+	result := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(c.TLSCAFile) != 0 {
+		pool, err := config.LoadCertPool(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		result.RootCAs = pool
+	}
+
+	if len(c.TLSCertFile) != 0 || len(c.TLSKeyFile) != 0 {
+		certificate, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load client certificate: %s", err)
+		}
+		result.Certificates = []tls.Certificate{certificate}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,358 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"go-metricscol/internal/models"
+)
+
+const (
+	// segmentHeaderSize is size of the offset of the first unsent record stored at the beginning of segment file.
+	segmentHeaderSize = 8
+	// recordHeaderSize is size of record length and checksum preceding every record in segment file.
+	recordHeaderSize = 8
+)
+
+// errQueueLocked is returned by OpenQueue if queue file is used by another agent.
+var errQueueLocked = errors.New("queue file is locked by another agent")
+
+// queueRecord is a single batch of metrics waiting to be sent.
+type queueRecord struct {
+	seq     uint64
+	payload []byte
+}
+
+func (r queueRecord) size() int64 {
+	return int64(recordHeaderSize + len(r.payload))
+}
+
+// Queue is a write-ahead queue of metrics batches.
+// Batches are appended to the segment file before they are sent and removed after server accepted them,
+// so batches survive agent restart. If the size of the queue exceeds maxSize, the oldest batches are dropped.
+// Queue with empty path keeps batches only in memory.
+// Queue file is locked with path.lock file while queue is open, so agents must not share the queue file.
+//
+// Segment file starts with the offset of the first unsent record, which is moved forward when batches are removed.
+// Space of removed records is reclaimed when it takes more than half of the file or the queue becomes empty.
+type Queue struct {
+	path    string
+	maxSize int64
+	unlock  func() error
+
+	mu      sync.Mutex
+	file    *os.File
+	records []queueRecord
+	size    int64
+	nextSeq uint64
+	head    int64
+	end     int64
+
+	// drainMu allows only one Drain at a time, so batches are sent in order.
+	drainMu sync.Mutex
+}
+
+// OpenQueue opens segment file and loads batches saved by previous agent run.
+// Incomplete or corrupted tail of the file, e.g. after crash during write, is truncated.
+func OpenQueue(path string, maxSize int64) (*Queue, error) {
+	q := &Queue{path: path, maxSize: maxSize}
+	if len(path) == 0 {
+		return q, nil
+	}
+
+	// Lock is taken on a separate file, because queue file is replaced on compaction.
+	unlock, err := lockQueue(path + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open queue %s: %w", path, err)
+	}
+	q.unlock = unlock
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("couldn't open queue file: %s", err)
+	}
+	q.file = file
+
+	if err := q.load(); err != nil {
+		file.Close()
+		unlock()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// load reads records starting from the head offset and truncates invalid tail of the file.
+func (q *Queue) load() error {
+	header := make([]byte, segmentHeaderSize)
+	if _, err := io.ReadFull(q.file, header); err != nil {
+		// New or empty file.
+		q.head, q.end = segmentHeaderSize, segmentHeaderSize
+		return q.truncate()
+	}
+
+	info, err := q.file.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't stat queue file: %s", err)
+	}
+
+	q.head = int64(binary.BigEndian.Uint64(header))
+	if q.head < segmentHeaderSize || q.head > info.Size() {
+		log.Printf("Queue file %s has invalid head offset, dropping all batches", q.path)
+		q.head, q.end = segmentHeaderSize, segmentHeaderSize
+		return q.truncate()
+	}
+
+	if _, err := q.file.Seek(q.head, io.SeekStart); err != nil {
+		return fmt.Errorf("couldn't seek queue file: %s", err)
+	}
+
+	reader := bufio.NewReader(q.file)
+	recordHeader := make([]byte, recordHeaderSize)
+
+	q.end = q.head
+	for {
+		if _, err := io.ReadFull(reader, recordHeader); err != nil {
+			break
+		}
+
+		// Length of torn or corrupted record may be arbitrary, so it's checked before allocating payload.
+		length := int64(binary.BigEndian.Uint32(recordHeader[:4]))
+		if length > info.Size()-q.end-recordHeaderSize {
+			log.Printf("Queue file %s is corrupted, dropping batches after offset %d", q.path, q.end)
+			break
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			break
+		}
+
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(recordHeader[4:]) {
+			log.Printf("Queue file %s is corrupted, dropping batches after offset %d", q.path, q.end)
+			break
+		}
+
+		q.appendRecord(payload)
+		q.end += recordHeaderSize + int64(len(payload))
+	}
+
+	if err := q.file.Truncate(q.end); err != nil {
+		return fmt.Errorf("couldn't truncate queue file: %s", err)
+	}
+
+	return nil
+}
+
+func (q *Queue) appendRecord(payload []byte) {
+	q.records = append(q.records, queueRecord{seq: q.nextSeq, payload: payload})
+	q.size += recordHeaderSize + int64(len(payload))
+	q.nextSeq++
+}
+
+// Push appends batch to the end of the queue.
+// If queue exceeds its maximum size, the oldest batches are dropped.
+func (q *Queue) Push(batch []models.Metric) error {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal batch: %s", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.appendRecord(payload)
+	if q.file != nil {
+		record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+		binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+		record = append(record, payload...)
+
+		if _, err := q.file.WriteAt(record, q.end); err != nil {
+			return fmt.Errorf("couldn't write batch to queue file: %s", err)
+		}
+		q.end += int64(len(record))
+	}
+
+	dropped := 0
+	for q.maxSize > 0 && q.size > q.maxSize && len(q.records) > 0 {
+		q.removeHead()
+		dropped++
+	}
+
+	if dropped != 0 {
+		log.Printf("Queue exceeded maximum size of %d bytes, dropped %d oldest batches", q.maxSize, dropped)
+	}
+
+	return q.commit()
+}
+
+// Drain sends batches in order starting from the oldest one.
+// Batch is removed from queue if send returned no error or server rejected it permanently, see IsRejected.
+// Otherwise, e.g. if server is unavailable, Drain stops and returns the error, so the batch is sent again later.
+func (q *Queue) Drain(send func(batch []models.Metric) error) error {
+	q.drainMu.Lock()
+	defer q.drainMu.Unlock()
+
+	for {
+		q.mu.Lock()
+		if len(q.records) == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+		head := q.records[0]
+		q.mu.Unlock()
+
+		var batch []models.Metric
+		if err := json.Unmarshal(head.payload, &batch); err != nil {
+			log.Printf("Couldn't unmarshal batch from queue, dropping it: %s", err)
+		} else if err := send(batch); err != nil {
+			if !IsRejected(err) {
+				return err
+			}
+			log.Printf("Server rejected batch, dropping it: %s", err)
+		}
+
+		if err := q.remove(head.seq); err != nil {
+			return err
+		}
+	}
+}
+
+// remove deletes record with given seq if it wasn't already dropped.
+func (q *Queue) remove(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.records) == 0 || q.records[0].seq != seq {
+		return nil
+	}
+
+	q.removeHead()
+	return q.commit()
+}
+
+func (q *Queue) removeHead() {
+	q.size -= q.records[0].size()
+	q.head += q.records[0].size()
+	q.records = q.records[1:]
+}
+
+// commit persists head offset, reclaiming space of removed records if necessary, and syncs segment file.
+func (q *Queue) commit() error {
+	if q.file == nil {
+		return nil
+	}
+
+	switch {
+	case len(q.records) == 0:
+		q.head, q.end = segmentHeaderSize, segmentHeaderSize
+		return q.truncate()
+	case q.head-segmentHeaderSize > q.end/2:
+		return q.compact()
+	}
+
+	header := make([]byte, segmentHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(q.head))
+	if _, err := q.file.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("couldn't write queue file: %s", err)
+	}
+
+	return q.file.Sync()
+}
+
+// truncate empties segment file.
+func (q *Queue) truncate() error {
+	header := make([]byte, segmentHeaderSize)
+	binary.BigEndian.PutUint64(header, segmentHeaderSize)
+
+	if err := q.file.Truncate(0); err != nil {
+		return fmt.Errorf("couldn't truncate queue file: %s", err)
+	}
+	if _, err := q.file.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("couldn't write queue file: %s", err)
+	}
+
+	return q.file.Sync()
+}
+
+// compact atomically replaces segment file with the file containing only records stored in queue.
+func (q *Queue) compact() error {
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't create queue file: %s", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+
+	header := make([]byte, segmentHeaderSize)
+	binary.BigEndian.PutUint64(header, segmentHeaderSize)
+	writer.Write(header)
+
+	recordHeader := make([]byte, recordHeaderSize)
+	for _, record := range q.records {
+		binary.BigEndian.PutUint32(recordHeader[:4], uint32(len(record.payload)))
+		binary.BigEndian.PutUint32(recordHeader[4:], crc32.ChecksumIEEE(record.payload))
+		writer.Write(recordHeader)
+		writer.Write(record.payload)
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("couldn't write queue file: %s", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("couldn't sync queue file: %s", err)
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		tmp.Close()
+		return fmt.Errorf("couldn't replace queue file: %s", err)
+	}
+
+	q.file.Close()
+	q.file = tmp
+	q.head = segmentHeaderSize
+	q.end = segmentHeaderSize + q.size
+
+	return nil
+}
+
+// Len returns number of batches in queue.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.records)
+}
+
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+
+	err := q.file.Close()
+	q.file = nil
+	if errors.Is(err, os.ErrClosed) {
+		err = nil
+	}
+
+	if unlockErr := q.unlock(); err == nil {
+		err = unlockErr
+	}
+
+	return err
+}
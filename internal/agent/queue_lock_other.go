@@ -0,0 +1,26 @@
+//go:build !unix
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockQueue creates the lock file, so queue file isn't used by two agents at once.
+// Lock file is removed by the returned function, it must be removed manually if agent crashed.
+func lockQueue(path string) (func() error, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, errQueueLocked
+		}
+		return nil, fmt.Errorf("couldn't create queue lock file: %s", err)
+	}
+
+	return func() error {
+		file.Close()
+		return os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockQueue takes exclusive lock of the lock file, so queue file isn't used by two agents at once.
+// Lock is released by the returned function or by the system when agent exits, e.g. after crash.
+func lockQueue(path string) (func() error, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open queue lock file: %s", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errQueueLocked
+		}
+		return nil, fmt.Errorf("couldn't lock queue file: %s", err)
+	}
+
+	return file.Close, nil
+}
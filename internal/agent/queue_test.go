@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/utils"
+)
+
+func testBatch(pollCount int64) []models.Metric {
+	return []models.Metric{{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(pollCount)}}
+}
+
+// testBatchSize is size of testBatch record in segment file.
+var testBatchSize = int64(recordHeaderSize + len(`[{"id":"PollCount","type":"counter","delta":1}]`))
+
+func drainPollCounts(t *testing.T, q *Queue) []int64 {
+	var result []int64
+	require.NoError(t, q.Drain(func(batch []models.Metric) error {
+		result = append(result, *batch[0].Delta)
+		return nil
+	}))
+
+	return result
+}
+
+func TestQueue_DrainInOrder(t *testing.T) {
+	q, err := OpenQueue(filepath.Join(t.TempDir(), "queue.wal"), 0)
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Push(testBatch(1)))
+	require.NoError(t, q.Push(testBatch(2)))
+
+	sendErr := errors.New("connection refused")
+	err = q.Drain(func(batch []models.Metric) error {
+		return sendErr
+	})
+	assert.ErrorIs(t, err, sendErr)
+	assert.Equal(t, 2, q.Len())
+
+	require.NoError(t, q.Push(testBatch(3)))
+	assert.Equal(t, []int64{1, 2, 3}, drainPollCounts(t, q))
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueue_DrainDropsRejected(t *testing.T) {
+	q, err := OpenQueue(filepath.Join(t.TempDir(), "queue.wal"), 0)
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, q.Push(testBatch(i)))
+	}
+
+	// The first batch is rejected because of hash mismatch, newer batches must not wait behind it.
+	var sent []int64
+	err = q.Drain(func(batch []models.Metric) error {
+		if *batch[0].Delta == 1 {
+			return rejectedError{err: errors.New("status code: 400, hash mismatch")}
+		}
+		sent = append(sent, *batch[0].Delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, sent)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueue_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q, err := OpenQueue(path, 0)
+	require.NoError(t, err)
+
+	for i := int64(1); i <= 4; i++ {
+		require.NoError(t, q.Push(testBatch(i)))
+	}
+
+	// Only the first batch is accepted by server.
+	sent := 0
+	_ = q.Drain(func(batch []models.Metric) error {
+		if sent == 1 {
+			return errors.New("server is unavailable")
+		}
+		sent++
+		return nil
+	})
+	require.NoError(t, q.Close())
+
+	t.Run("Restores unsent batches", func(t *testing.T) {
+		q, err := OpenQueue(path, 0)
+		require.NoError(t, err)
+		defer q.Close()
+
+		assert.Equal(t, []int64{2, 3, 4}, drainPollCounts(t, q))
+	})
+
+	t.Run("Empty after drain", func(t *testing.T) {
+		q, err := OpenQueue(path, 0)
+		require.NoError(t, err)
+		defer q.Close()
+
+		assert.Equal(t, 0, q.Len())
+	})
+}
+
+func TestQueue_Locked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q, err := OpenQueue(path, 0)
+	require.NoError(t, err)
+
+	_, err = OpenQueue(path, 0)
+	assert.ErrorIs(t, err, errQueueLocked)
+
+	require.NoError(t, q.Close())
+
+	q, err = OpenQueue(path, 0)
+	require.NoError(t, err)
+	assert.NoError(t, q.Close())
+}
+
+func TestQueue_TruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q, err := OpenQueue(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, q.Push(testBatch(1)))
+	require.NoError(t, q.Push(testBatch(2)))
+	require.NoError(t, q.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	q, err = OpenQueue(path, 0)
+	require.NoError(t, err)
+	defer q.Close()
+
+	assert.Equal(t, []int64{1}, drainPollCounts(t, q))
+}
+
+func TestQueue_CorruptedLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q, err := OpenQueue(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, q.Push(testBatch(1)))
+	require.NoError(t, q.Push(testBatch(2)))
+	require.NoError(t, q.Close())
+
+	// Length of the second record is corrupted to the maximum value.
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, segmentHeaderSize+testBatchSize)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	q, err = OpenQueue(path, 0)
+	require.NoError(t, err)
+	defer q.Close()
+
+	assert.Equal(t, []int64{1}, drainPollCounts(t, q))
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	q, err := OpenQueue(filepath.Join(t.TempDir(), "queue.wal"), 2*testBatchSize)
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := int64(1); i <= 5; i++ {
+		require.NoError(t, q.Push(testBatch(i)))
+	}
+
+	assert.Equal(t, []int64{4, 5}, drainPollCounts(t, q))
+}
+
+func TestQueue_InMemory(t *testing.T) {
+	q, err := OpenQueue("", 0)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Push(testBatch(1)))
+	assert.Equal(t, []int64{1}, drainPollCounts(t, q))
+	assert.NoError(t, q.Close())
+}
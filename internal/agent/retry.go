@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// RetryPolicy describes how failed requests to the server are repeated.
+// Backoff starts from InitialBackoff and doubles after every attempt up to MaxBackoff.
+// Every backoff is randomly changed by up to Jitter fraction of it, so agents don't retry simultaneously.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+}
+
+// DefaultRetryPolicy is used if retry policy isn't configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     5 * time.Second,
+	Jitter:         0.2,
+}
+
+// retryableError is an error after which request may succeed if it's repeated, e.g. connection error.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryableError) Unwrap() error {
+	return e.err
+}
+
+// IsRetryable returns true if request failed with err may succeed if it's repeated.
+func IsRetryable(err error) bool {
+	var retryable retryableError
+	return errors.As(err, &retryable)
+}
+
+// rejectedError is an error of request which server rejected permanently, e.g. because of hash mismatch or invalid token.
+// Sending the same batch again won't succeed, so it's dropped from queue instead of blocking newer batches.
+type rejectedError struct {
+	err error
+}
+
+func (e rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e rejectedError) Unwrap() error {
+	return e.err
+}
+
+// IsRejected returns true if request failed with err was rejected by server and will never succeed.
+func IsRejected(err error) bool {
+	var rejected rejectedError
+	return errors.As(err, &rejected)
+}
+
+// retryableHTTPStatus returns true for server errors and 429 Too Many Requests.
+// Other client errors, e.g. hash mismatch, are not fixed by retrying.
+func retryableHTTPStatus(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
+
+// rejectedHTTPStatus returns true for client errors except 429 Too Many Requests.
+func rejectedHTTPStatus(statusCode int) bool {
+	return statusCode >= http.StatusBadRequest && statusCode < http.StatusInternalServerError &&
+		statusCode != http.StatusTooManyRequests
+}
+
+// retryableGrpcCode returns true if server is unavailable or out of resources.
+func retryableGrpcCode(code codes.Code) bool {
+	return code == codes.Unavailable || code == codes.ResourceExhausted
+}
+
+// rejectedGrpcCode returns true for codes server returns for client errors, see apierror.GRPCCode.
+func rejectedGrpcCode(code codes.Code) bool {
+	switch code {
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied,
+		codes.NotFound, codes.Unimplemented, codes.FailedPrecondition:
+		return true
+	}
+
+	return false
+}
+
+// Do calls send until it succeeds, returns not retryable error or MaxAttempts is reached.
+func (p RetryPolicy) Do(send func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = send()
+		if err == nil || !IsRetryable(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		time.Sleep(p.backoff(attempt))
+	}
+}
+
+// backoff returns delay after the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		backoff += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(backoff))
+	}
+
+	return backoff
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicy_Do(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	retryable := retryableError{err: errors.New("connection refused")}
+	notRetryable := errors.New("hash mismatch")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{
+			name:     "Success",
+			errs:     []error{nil},
+			attempts: 1,
+		},
+		{
+			name:     "Success after retry",
+			errs:     []error{retryable, retryable, nil},
+			attempts: 3,
+		},
+		{
+			name:     "Max attempts reached",
+			errs:     []error{retryable, retryable, retryable, nil},
+			attempts: 3,
+			err:      retryable,
+		},
+		{
+			name:     "Not retryable error",
+			errs:     []error{notRetryable, nil},
+			attempts: 1,
+			err:      notRetryable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := policy.Do(func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.attempts, attempts)
+		})
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, policy.backoff(1))
+	assert.Equal(t, 2*time.Second, policy.backoff(2))
+	assert.Equal(t, 4*time.Second, policy.backoff(3))
+	assert.Equal(t, 5*time.Second, policy.backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := policy.backoff(2)
+		assert.GreaterOrEqual(t, backoff, time.Second)
+		assert.LessOrEqual(t, backoff, 3*time.Second)
+	}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	assert.True(t, retryableHTTPStatus(http.StatusServiceUnavailable))
+	assert.True(t, retryableHTTPStatus(http.StatusTooManyRequests))
+	assert.False(t, retryableHTTPStatus(http.StatusBadRequest))
+
+	assert.True(t, IsRetryable(statusError(status.Error(codes.Unavailable, "connection refused"))))
+	assert.True(t, IsRetryable(statusError(status.Error(codes.ResourceExhausted, "too many requests"))))
+	assert.False(t, IsRetryable(statusError(status.Error(codes.InvalidArgument, "hash mismatch"))))
+	assert.NoError(t, statusError(nil))
+
+	assert.True(t, rejectedHTTPStatus(http.StatusBadRequest))
+	assert.True(t, rejectedHTTPStatus(http.StatusUnauthorized))
+	assert.True(t, rejectedHTTPStatus(http.StatusRequestEntityTooLarge))
+	assert.False(t, rejectedHTTPStatus(http.StatusTooManyRequests))
+	assert.False(t, rejectedHTTPStatus(http.StatusServiceUnavailable))
+
+	assert.True(t, IsRejected(statusError(status.Error(codes.InvalidArgument, "hash mismatch"))))
+	assert.True(t, IsRejected(statusError(status.Error(codes.Unauthenticated, "invalid token"))))
+	assert.False(t, IsRejected(statusError(status.Error(codes.Unavailable, "connection refused"))))
+	assert.False(t, IsRejected(statusError(status.Error(codes.Internal, "internal error"))))
+}
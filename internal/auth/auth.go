@@ -0,0 +1,57 @@
+// Package auth implements authentication of agents with bearer tokens.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrUnknownToken is returned by TokenStore if token doesn't exist or is revoked.
+var ErrUnknownToken = errors.New("unknown or revoked token")
+
+// Agent is identity of the agent which token is issued to.
+type Agent struct {
+	Name string
+	Role Role
+	// Tenant is the only tenant agent has access to, agent chooses tenant itself if it is empty.
+	Tenant string
+}
+
+// TokenStore finds agents by their tokens.
+// Implementations must see revoked tokens without restart of the server.
+type TokenStore interface {
+	LookupToken(ctx context.Context, token string) (Agent, error)
+}
+
+// HashToken returns SHA-256 of token, tokens are looked up by their hashes, so raw tokens are never compared.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// ParseBearer returns token from the value of Authorization header in format "Bearer <token>".
+func ParseBearer(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, len(token) != 0
+}
+
+type agentKey struct{}
+
+// NewContext returns context with authenticated agent.
+func NewContext(ctx context.Context, agent Agent) context.Context {
+	return context.WithValue(ctx, agentKey{}, agent)
+}
+
+// FromContext returns agent authenticated by the server middleware.
+func FromContext(ctx context.Context) (Agent, bool) {
+	agent, ok := ctx.Value(agentKey{}).(Agent)
+	return agent, ok
+}
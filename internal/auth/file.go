@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-metricscol/internal/tenant"
+)
+
+// FileTokenStore is TokenStore which reads tokens from file. Every line of the file has format "<token> <agent> [role [tenant]]",
+// DefaultRole is used if role is omitted. Empty lines and lines starting with # are skipped.
+// File is read again when it's modified, so token is revoked by removing it from the file.
+type FileTokenStore struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	agents  map[string]Agent
+}
+
+// NewFileTokenStore reads tokens from file at the given path.
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	store := &FileTokenStore{path: path}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// LookupToken returns agent which token is issued to.
+// If token file can't be read, error is returned, so revoked tokens are never accepted.
+func (s *FileTokenStore) LookupToken(_ context.Context, token string) (Agent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return Agent{}, err
+	}
+
+	agent, ok := s.agents[HashToken(token)]
+	if !ok {
+		return Agent{}, ErrUnknownToken
+	}
+
+	return agent, nil
+}
+
+// reload reads token file if it was modified since the last read.
+func (s *FileTokenStore) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("couldn't stat token file: %s", err)
+	}
+
+	if s.agents != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("couldn't read token file: %s", err)
+	}
+
+	agents, err := parseTokenFile(content)
+	if err != nil {
+		return err
+	}
+
+	s.agents = agents
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+
+	return nil
+}
+
+func parseTokenFile(content []byte) (map[string]Agent, error) {
+	agents := make(map[string]Agent)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("invalid token file line %d: expected \"<token> <agent> [role [tenant]]\"", line)
+		}
+
+		agent := Agent{Name: fields[1], Role: DefaultRole}
+		if len(fields) >= 3 {
+			role, err := ParseRole(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid token file line %d: %s", line, err)
+			}
+			agent.Role = role
+		}
+		if len(fields) == 4 {
+			if err := tenant.Validate(fields[3]); err != nil {
+				return nil, fmt.Errorf("invalid token file line %d: %s", line, err)
+			}
+			agent.Tenant = fields[3]
+		}
+
+		agents[HashToken(fields[0])] = agent
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read token file: %s", err)
+	}
+
+	return agents, nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTokenStore_LookupToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("# token agent [role [tenant]]\ntoken-1 agent-1\n\ntoken-2 agent-2 reader team-a\n"), 0600))
+
+	store, err := NewFileTokenStore(path)
+	require.NoError(t, err)
+
+	agent, err := store.LookupToken(context.Background(), "token-1")
+	require.NoError(t, err)
+	assert.Equal(t, Agent{Name: "agent-1", Role: Writer}, agent)
+
+	_, err = store.LookupToken(context.Background(), "token-3")
+	assert.ErrorIs(t, err, ErrUnknownToken)
+
+	agent, err = store.LookupToken(context.Background(), "token-2")
+	require.NoError(t, err)
+	assert.Equal(t, Agent{Name: "agent-2", Role: Reader, Tenant: "team-a"}, agent)
+
+	// Token is revoked without recreating the store.
+	require.NoError(t, os.WriteFile(path, []byte("token-2 agent-2 reader\n"), 0600))
+
+	_, err = store.LookupToken(context.Background(), "token-1")
+	assert.ErrorIs(t, err, ErrUnknownToken)
+
+	agent, err = store.LookupToken(context.Background(), "token-2")
+	require.NoError(t, err)
+	assert.Equal(t, Agent{Name: "agent-2", Role: Reader}, agent)
+
+	// Tokens are not accepted if file can't be read.
+	require.NoError(t, os.Remove(path))
+	_, err = store.LookupToken(context.Background(), "token-2")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnknownToken)
+}
+
+func TestNewFileTokenStore_InvalidFile(t *testing.T) {
+	for _, content := range []string{"token-1\n", "token-1 agent-1 owner\n", "token-1 agent-1 reader team/a\n"} {
+		path := filepath.Join(t.TempDir(), "tokens")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+		_, err := NewFileTokenStore(path)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, Reader.Allows(Reader))
+	assert.False(t, Reader.Allows(Writer))
+	assert.True(t, Writer.Allows(Reader))
+	assert.False(t, Writer.Allows(Admin))
+	assert.True(t, Admin.Allows(Writer))
+	assert.False(t, Role("").Allows(Reader))
+}
+
+func TestParseBearer(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{header: "Bearer token-1", token: "token-1", ok: true},
+		{header: "bearer token-1", token: "token-1", ok: true},
+		{header: "Basic dXNlcjpwYXNz"},
+		{header: "Bearer "},
+		{header: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			token, ok := ParseBearer(tt.header)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.token, token)
+		})
+	}
+}
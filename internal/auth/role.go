@@ -0,0 +1,47 @@
+package auth
+
+import "fmt"
+
+// Role describes which API methods agent is allowed to call.
+// Roles are ordered: every role is allowed to do everything the previous one can.
+type Role string
+
+const (
+	// Reader can only read metrics.
+	Reader Role = "reader"
+	// Writer can read and update metrics.
+	Writer Role = "writer"
+	// Admin can call every API method.
+	Admin Role = "admin"
+)
+
+// DefaultRole is given to tokens without explicit role, so existing agent tokens keep sending metrics.
+const DefaultRole = Writer
+
+// ParseRole parses role name.
+func ParseRole(name string) (Role, error) {
+	switch Role(name) {
+	case Reader, Writer, Admin:
+		return Role(name), nil
+	}
+
+	return "", fmt.Errorf("unknown role %q", name)
+}
+
+func (r Role) rank() int {
+	switch r {
+	case Reader:
+		return 1
+	case Writer:
+		return 2
+	case Admin:
+		return 3
+	}
+
+	return 0
+}
+
+// Allows returns true if role is allowed to call methods which require the given role.
+func (r Role) Allows(required Role) bool {
+	return r.rank() != 0 && r.rank() >= required.rank()
+}
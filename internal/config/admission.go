@@ -0,0 +1,28 @@
+package config
+
+import (
+	"time"
+)
+
+// Reasons of writes rejected by series limits, see instrument.RejectedWrites.
+const (
+	RejectedTenantSeriesQuota = "tenant_series_quota"
+	RejectedMaxSeries         = "max_series"
+	RejectedNewSeriesRate     = "new_series_rate"
+)
+
+// SeriesAdmission limits the rate of new series created on the server.
+type SeriesAdmission struct {
+	limiter *RateLimiter
+}
+
+// NewSeriesAdmission returns new instance of SeriesAdmission.
+func NewSeriesAdmission() *SeriesAdmission {
+	return &SeriesAdmission{limiter: NewRateLimiter()}
+}
+
+// AllowNew returns false if creating n new series exceeds perMinute new series in a minute.
+// Up to perMinute series may be created at once, every request is allowed if perMinute is not positive.
+func (a *SeriesAdmission) AllowNew(n int, perMinute int, now time.Time) bool {
+	return a.limiter.AllowN("", float64(n), float64(perMinute)/60, float64(perMinute), now)
+}
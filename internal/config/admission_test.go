@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesAdmission_AllowNew(t *testing.T) {
+	admission := NewSeriesAdmission()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.True(t, admission.AllowNew(60, 60, now))
+	assert.False(t, admission.AllowNew(1, 60, now))
+
+	// One series is allowed every second.
+	assert.True(t, admission.AllowNew(1, 60, now.Add(time.Second)))
+	assert.False(t, admission.AllowNew(2, 60, now.Add(2*time.Second)))
+	assert.True(t, admission.AllowNew(1, 60, now.Add(2*time.Second)))
+
+	// Batch larger than the limit is never allowed.
+	assert.False(t, admission.AllowNew(61, 60, now.Add(time.Hour)))
+
+	assert.True(t, admission.AllowNew(1000, 0, now), "zero limit is unlimited")
+}
@@ -6,14 +6,19 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/instrument"
 	"go-metricscol/internal/models"
 )
 
 // ServerConfig describes parameters required for Server.
 type ServerConfig struct {
-	Address       string
+	Address string
+	// GRPCAddress is address of grpc server, which is started next to HTTP server if not empty.
+	GRPCAddress   string
 	StoreInterval time.Duration
 	StoreFile     string
 	Restore       bool
@@ -21,6 +26,135 @@ type ServerConfig struct {
 	DatabaseDSN   string
 	CryptoKey     *rsa.PrivateKey
 	TrustedSubnet string
+
+	// Retention describes how long samples of metrics history are kept.
+	// Compaction is disabled if Retention is empty or CompactInterval is zero.
+	Retention       models.Retention
+	CompactInterval time.Duration
+
+	// StoreGenerations is the number of previous store files kept to restore metrics if StoreFile is corrupt.
+	StoreGenerations int
+
+	// StatsDAddress is UDP address of StatsD listener, listener is disabled if it is empty.
+	StatsDAddress       string
+	StatsDFlushInterval time.Duration
+
+	// TLSCertFile and TLSKeyFile are PEM encoded certificate and private key of the server, TLS is disabled if they are empty.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile is PEM encoded bundle of CA certificates.
+	// If it is set, clients are required to present certificate signed by one of them (mutual TLS).
+	TLSClientCAFile string
+
+	// ReplayWindow is maximum allowed difference between server time and timestamp of signed metric.
+	// Replay protection is disabled if it is zero.
+	ReplayWindow time.Duration
+	// NonceCacheSize is the number of the latest nonces of signed metrics remembered to reject replayed metrics.
+	NonceCacheSize int
+
+	// AuthTokensFile is a file with bearer tokens of agents, see auth.FileTokenStore.
+	AuthTokensFile string
+	// AuthTokensFromDB enables reading bearer tokens of agents from agent_tokens table of the database.
+	AuthTokensFromDB bool
+	// Tokens finds agents by bearer tokens, authentication is disabled if it is nil.
+	Tokens auth.TokenStore
+
+	// MaxSeries is the maximum number of series of all tenants, unlimited if zero.
+	MaxSeries int
+	// MaxNewSeriesPerMinute is the maximum number of series created in a minute by all tenants, unlimited if zero.
+	MaxNewSeriesPerMinute int
+
+	// TenantFromHeader allows requests of agents not bound to a tenant to select any tenant with tenant header or metadata.
+	// Otherwise such requests may use only the default tenant.
+	TenantFromHeader bool
+
+	// TenantQuota limits usage of every tenant which has no quota in TenantQuotas.
+	TenantQuota  TenantQuota
+	TenantQuotas map[string]TenantQuota
+
+	nonceCacheOnce sync.Once
+	nonceCache     *NonceCache
+
+	tenantLimiterOnce sync.Once
+	tenantLimiter     *RateLimiter
+
+	admissionOnce sync.Once
+	admission     *SeriesAdmission
+
+	instrumentsOnce sync.Once
+	instruments     *instrument.Registry
+}
+
+// TenantQuota limits usage of the server by a single tenant, zero limits are disabled.
+type TenantQuota struct {
+	// MaxSeries is the maximum number of series stored by tenant.
+	MaxSeries int `json:"max_series,omitempty"`
+	// RateLimit is the maximum number of requests of tenant per second.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+}
+
+var (
+	DefaultNonceCacheSize   = 100000
+	DefaultStoreGenerations = 2
+)
+
+// NonceCache returns cache of nonces shared by all backends of the server.
+func (c *ServerConfig) NonceCache() *NonceCache {
+	c.nonceCacheOnce.Do(func() {
+		c.nonceCache = NewNonceCache(c.NonceCacheSize)
+	})
+
+	return c.nonceCache
+}
+
+// Validate checks that parameters assigned after NewServerConfig are consistent.
+func (c *ServerConfig) Validate() error {
+	if len(c.StatsDAddress) > 0 && c.StatsDFlushInterval <= 0 {
+		return fmt.Errorf("statsd flush interval must be positive, got %s", c.StatsDFlushInterval)
+	}
+
+	// Replayed requests aren't detected within replay window without remembered nonces.
+	if c.ReplayWindow != 0 && c.NonceCacheSize <= 0 {
+		return fmt.Errorf("nonce cache size must be positive if replay protection is enabled, got %d", c.NonceCacheSize)
+	}
+
+	return nil
+}
+
+// Quota returns quota of the given tenant.
+func (c *ServerConfig) Quota(tenant string) TenantQuota {
+	if quota, ok := c.TenantQuotas[tenant]; ok {
+		return quota
+	}
+
+	return c.TenantQuota
+}
+
+// TenantLimiter returns limiter of tenant requests shared by all backends of the server.
+func (c *ServerConfig) TenantLimiter() *RateLimiter {
+	c.tenantLimiterOnce.Do(func() {
+		c.tenantLimiter = NewRateLimiter()
+	})
+
+	return c.tenantLimiter
+}
+
+// Admission returns series admission control shared by all backends of the server.
+func (c *ServerConfig) Admission() *SeriesAdmission {
+	c.admissionOnce.Do(func() {
+		c.admission = NewSeriesAdmission()
+	})
+
+	return c.admission
+}
+
+// Instruments returns registry of server metrics shared by all backends of the server.
+func (c *ServerConfig) Instruments() *instrument.Registry {
+	c.instrumentsOnce.Do(func() {
+		c.instruments = instrument.NewRegistry()
+	})
+
+	return c.instruments
 }
 
 func rsaPrivateKeyParser(input string) (*rsa.PrivateKey, error) {
@@ -58,13 +192,14 @@ func NewServerConfig(
 	}
 
 	return &ServerConfig{
-		Address:       address,
-		StoreInterval: storeInterval.Duration,
-		StoreFile:     storeFile,
-		Restore:       restore,
-		HashKey:       hashKey,
-		DatabaseDSN:   databaseDSN,
-		CryptoKey:     cryptoKey,
-		TrustedSubnet: trustedSubnet,
+		Address:        address,
+		StoreInterval:  storeInterval.Duration,
+		StoreFile:      storeFile,
+		Restore:        restore,
+		HashKey:        hashKey,
+		DatabaseDSN:    databaseDSN,
+		CryptoKey:      cryptoKey,
+		TrustedSubnet:  trustedSubnet,
+		NonceCacheSize: DefaultNonceCacheSize,
 	}, nil
 }
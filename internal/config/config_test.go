@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/models"
+)
+
+func TestServerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *ServerConfig
+		wantErr bool
+	}{
+		{
+			name:   "StatsD and replay protection are disabled",
+			config: &ServerConfig{},
+		},
+		{
+			name:   "StatsD flush interval is positive",
+			config: &ServerConfig{StatsDAddress: ":8125", StatsDFlushInterval: 10 * time.Second},
+		},
+		{
+			name:    "StatsD flush interval is zero",
+			config:  &ServerConfig{StatsDAddress: ":8125"},
+			wantErr: true,
+		},
+		{
+			name:    "StatsD flush interval is negative",
+			config:  &ServerConfig{StatsDAddress: ":8125", StatsDFlushInterval: -time.Second},
+			wantErr: true,
+		},
+		{
+			name:   "Nonce cache size is positive",
+			config: &ServerConfig{ReplayWindow: time.Minute, NonceCacheSize: 10},
+		},
+		{
+			name:    "Nonce cache size is zero",
+			config:  &ServerConfig{ReplayWindow: time.Minute},
+			wantErr: true,
+		},
+		{
+			name:    "Nonce cache size is negative",
+			config:  &ServerConfig{ReplayWindow: time.Minute, NonceCacheSize: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewServerConfig_ReplayDisabled(t *testing.T) {
+	cfg, err := NewServerConfig("", models.Duration{}, "", false, "secret", "", "", "")
+	require.NoError(t, err)
+
+	// Agents of older versions don't sign timestamp and nonce, so replay protection is opt-in.
+	assert.Zero(t, cfg.ReplayWindow)
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,44 @@
+package config
+
+import "sync"
+
+// NonceCache is a bounded set of nonces of signed requests seen by the server.
+// When the cache is full, the oldest nonce is evicted.
+type NonceCache struct {
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string
+	next  int
+}
+
+// NewNonceCache returns NonceCache which keeps at most size nonces.
+func NewNonceCache(size int) *NonceCache {
+	return &NonceCache{
+		seen:  make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+// Add remembers nonce and returns false if it has already been seen.
+func (c *NonceCache) Add(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+
+	if len(c.order) == 0 {
+		return true
+	}
+
+	if evicted := c.order[c.next]; len(evicted) != 0 {
+		delete(c.seen, evicted)
+	}
+
+	c.order[c.next] = nonce
+	c.next = (c.next + 1) % len(c.order)
+	c.seen[nonce] = struct{}{}
+
+	return true
+}
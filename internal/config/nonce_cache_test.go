@@ -0,0 +1,21 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceCache_Add(t *testing.T) {
+	cache := NewNonceCache(2)
+
+	assert.True(t, cache.Add("a"))
+	assert.False(t, cache.Add("a"))
+	assert.True(t, cache.Add("b"))
+	assert.False(t, cache.Add("a"))
+
+	// The oldest nonce is evicted when cache is full.
+	assert.True(t, cache.Add("c"))
+	assert.True(t, cache.Add("a"))
+	assert.False(t, cache.Add("c"))
+}
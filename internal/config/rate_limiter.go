@@ -0,0 +1,60 @@
+package config
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a set of token buckets identified by keys, e.g. tenant names.
+// Bucket of the key is refilled with rate tokens per second.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns new instance of RateLimiter.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token from the bucket of the key and returns false if the bucket is empty.
+// Every request is allowed if rate is not positive.
+func (l *RateLimiter) Allow(key string, rate float64, now time.Time) bool {
+	return l.AllowN(key, 1, rate, math.Max(1, rate), now)
+}
+
+// AllowN takes n tokens from the bucket of the key holding up to burst tokens.
+// If the bucket has less than n tokens, no tokens are taken and false is returned.
+// Every request is allowed if rate is not positive.
+func (l *RateLimiter) AllowN(key string, n float64, rate float64, burst float64, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed.Seconds()*rate)
+		bucket.updated = now
+	}
+
+	if bucket.tokens < n {
+		return false
+	}
+
+	bucket.tokens -= n
+	return true
+}
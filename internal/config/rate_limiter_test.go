@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := NewRateLimiter()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.True(t, limiter.Allow("team-a", 2, now))
+	assert.True(t, limiter.Allow("team-a", 2, now))
+	assert.False(t, limiter.Allow("team-a", 2, now))
+
+	// Buckets of other keys are independent.
+	assert.True(t, limiter.Allow("team-b", 2, now))
+
+	// Bucket is refilled with time.
+	assert.True(t, limiter.Allow("team-a", 2, now.Add(500*time.Millisecond)))
+	assert.False(t, limiter.Allow("team-a", 2, now.Add(500*time.Millisecond)))
+
+	// Zero rate is unlimited.
+	for i := 0; i < 10; i++ {
+		assert.True(t, limiter.Allow("team-c", 0, now))
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSConfig returns TLS configuration of the server or nil if TLS is disabled.
+// If TLSClientCAFile is set, client certificates are required and verified.
+func (c *ServerConfig) TLSConfig() (*tls.Config, error) {
+	if len(c.TLSCertFile) == 0 && len(c.TLSKeyFile) == 0 {
+		if len(c.TLSClientCAFile) != 0 {
+			return nil, errors.New("client CA is set without server certificate")
+		}
+		return nil, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load server certificate: %s", err)
+	}
+
+	result := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if len(c.TLSClientCAFile) != 0 {
+		pool, err := LoadCertPool(c.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		result.ClientCAs = pool
+		result.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return result, nil
+}
+
+// LoadCertPool reads PEM encoded bundle of CA certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read CA bundle: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("couldn't find certificates in CA bundle %s", path)
+	}
+
+	return pool, nil
+}
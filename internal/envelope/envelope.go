@@ -0,0 +1,98 @@
+// Package envelope implements hybrid encryption of payloads sent from agent to server.
+//
+// Payload is encrypted with random AES-256-GCM key, which is encrypted with RSA-OAEP public key of the server,
+// so payloads of any size can be encrypted. Envelope has the following format:
+//
+//	[RSA-OAEP encrypted AES key][GCM nonce][AES-GCM encrypted payload]
+//
+// Size of the encrypted key is equal to the size of RSA modulus.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// keySize is size of AES-256 key.
+const keySize = 32
+
+// ErrMalformed is returned if envelope is too short to contain encrypted key and nonce.
+var ErrMalformed = errors.New("malformed envelope")
+
+// Encrypt encrypts payload with random AES key and encrypts the key with publicKey.
+func Encrypt(publicKey *rsa.PublicKey, payload []byte) ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("couldn't generate key: %s", err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encrypt key: %s", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("couldn't generate nonce: %s", err)
+	}
+
+	result := make([]byte, 0, len(encryptedKey)+len(nonce)+len(payload)+gcm.Overhead())
+	result = append(result, encryptedKey...)
+	result = append(result, nonce...)
+
+	return gcm.Seal(result, nonce, payload, nil), nil
+}
+
+// Decrypt decrypts AES key with privateKey and returns payload decrypted with it.
+func Decrypt(privateKey *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	keyEnd := privateKey.Size()
+	if len(envelope) < keyEnd {
+		return nil, ErrMalformed
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, envelope[:keyEnd], nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt key: %s", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceEnd := keyEnd + gcm.NonceSize()
+	if len(envelope) < nonceEnd {
+		return nil, ErrMalformed
+	}
+
+	payload, err := gcm.Open(nil, envelope[keyEnd:nonceEnd], envelope[nonceEnd:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt payload: %s", err)
+	}
+
+	return payload, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create cipher: %s", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create gcm: %s", err)
+	}
+
+	return gcm, nil
+}
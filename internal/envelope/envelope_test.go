@@ -0,0 +1,61 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{
+			name:    "Small payload",
+			payload: []byte(`{"id":"Alloc","type":"gauge","value":1}`),
+		},
+		{
+			name:    "Payload larger than RSA key",
+			payload: bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1},`), 1000),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt(&privateKey.PublicKey, tt.payload)
+			require.NoError(t, err)
+
+			decrypted, err := Decrypt(privateKey, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, tt.payload, decrypted)
+		})
+	}
+}
+
+func TestDecrypt_Invalid(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	encrypted, err := Encrypt(&privateKey.PublicKey, []byte("payload"))
+	require.NoError(t, err)
+
+	_, err = Decrypt(privateKey, encrypted[:10])
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	_, err = Decrypt(otherKey, encrypted)
+	assert.Error(t, err)
+
+	tampered := bytes.Clone(encrypted)
+	tampered[len(tampered)-1] ^= 1
+	_, err = Decrypt(privateKey, tampered)
+	assert.Error(t, err)
+}
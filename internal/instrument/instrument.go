@@ -0,0 +1,98 @@
+// Package instrument records metrics of the server itself, which are exposed on /metrics next to stored metrics.
+package instrument
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/repository/memory"
+)
+
+// Prefix is reserved for names of server metrics, clients can't store metrics with such names.
+const Prefix = "metricscol_"
+
+// Names of server metrics.
+const (
+	HTTPRequests           = Prefix + "http_requests_total"
+	HTTPRequestDuration    = Prefix + "http_request_duration_seconds"
+	GrpcRequests           = Prefix + "grpc_requests_total"
+	GrpcRequestDuration    = Prefix + "grpc_request_duration_seconds"
+	HashValidationFailures = Prefix + "hash_validation_failures_total"
+	DecryptFailures        = Prefix + "decrypt_failures_total"
+	DiskSaveDuration       = Prefix + "disk_save_duration_seconds"
+	DiskSaveFailures       = Prefix + "disk_save_failures_total"
+	PostgresErrors         = Prefix + "postgres_errors_total"
+	RejectedWrites         = Prefix + "rejected_writes_total"
+)
+
+// IsReserved returns true if name has Prefix.
+func IsReserved(name string) bool {
+	return strings.HasPrefix(name, Prefix)
+}
+
+// Registry stores counters and histograms of the server. Methods of nil Registry do nothing.
+type Registry struct {
+	metrics memory.Metrics
+}
+
+// NewRegistry returns new instance of Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: memory.NewMetrics()}
+}
+
+// Inc increments counter with the given labels.
+func (r *Registry) Inc(name string, labels models.Labels) {
+	if r == nil {
+		return
+	}
+
+	r.metrics.UpdateWithLabels(name, models.Counter, labels, 1)
+}
+
+// Observe adds value to histogram with the given labels, models.DefaultHistogramBuckets are used as bounds.
+func (r *Registry) Observe(name string, labels models.Labels, value float64) {
+	if r == nil {
+		return
+	}
+
+	r.metrics.UpdateWithLabels(name, models.Histogram, labels, value)
+}
+
+// ObserveSince adds seconds elapsed since start to histogram with the given labels.
+func (r *Registry) ObserveSince(name string, labels models.Labels, start time.Time) {
+	r.Observe(name, labels, time.Since(start).Seconds())
+}
+
+// Metrics returns all server metrics sorted by name and labels.
+func (r *Registry) Metrics() []models.Metric {
+	if r == nil {
+		return nil
+	}
+
+	all := r.metrics.GetAll()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Labels.String() < all[j].Labels.String()
+	})
+
+	return all
+}
+
+// TimeDiskSave calls save and records its duration in DiskSaveDuration, failed saves are counted in DiskSaveFailures.
+// Mode tells what triggered saving, e.g. "sync" for saving after every update.
+func (r *Registry) TimeDiskSave(mode string, save func() error) error {
+	start := time.Now()
+	err := save()
+
+	labels := models.Labels{"mode": mode}
+	r.ObserveSince(DiskSaveDuration, labels, start)
+	if err != nil {
+		r.Inc(DiskSaveFailures, labels)
+	}
+
+	return err
+}
@@ -0,0 +1,61 @@
+package instrument
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/models"
+)
+
+func TestIsReserved(t *testing.T) {
+	assert.True(t, IsReserved(RejectedWrites))
+	assert.False(t, IsReserved("Alloc"))
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Inc(HTTPRequests, models.Labels{"code": "200"})
+	registry.Inc(HTTPRequests, models.Labels{"code": "200"})
+	registry.Inc(HTTPRequests, models.Labels{"code": "500"})
+	registry.Observe(HTTPRequestDuration, nil, 0.5)
+
+	metrics := registry.Metrics()
+	require.Len(t, metrics, 3)
+
+	assert.Equal(t, HTTPRequestDuration, metrics[0].Name)
+	assert.Equal(t, models.Histogram, metrics[0].MType)
+	assert.Equal(t, 0.5, metrics[0].Histogram.Sum)
+
+	assert.Equal(t, models.Labels{"code": "200"}, metrics[1].Labels)
+	assert.Equal(t, int64(2), *metrics[1].Delta)
+	assert.Equal(t, models.Labels{"code": "500"}, metrics[2].Labels)
+	assert.Equal(t, int64(1), *metrics[2].Delta)
+}
+
+func TestRegistry_Nil(t *testing.T) {
+	var registry *Registry
+	registry.Inc(HTTPRequests, nil)
+	registry.Observe(HTTPRequestDuration, nil, 1)
+
+	assert.Nil(t, registry.Metrics())
+	assert.NoError(t, registry.TimeDiskSave("sync", func() error { return nil }))
+}
+
+func TestRegistry_TimeDiskSave(t *testing.T) {
+	registry := NewRegistry()
+
+	assert.NoError(t, registry.TimeDiskSave("sync", func() error { return nil }))
+	saveErr := errors.New("disk is full")
+	assert.ErrorIs(t, registry.TimeDiskSave("sync", func() error { return saveErr }), saveErr)
+
+	metrics := registry.Metrics()
+	require.Len(t, metrics, 2)
+
+	assert.Equal(t, DiskSaveDuration, metrics[0].Name)
+	assert.Equal(t, DiskSaveFailures, metrics[1].Name)
+	assert.Equal(t, models.Labels{"mode": "sync"}, metrics[1].Labels)
+	assert.Equal(t, int64(1), *metrics[1].Delta)
+}
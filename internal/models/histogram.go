@@ -0,0 +1,113 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-metricscol/internal/server/apierror"
+)
+
+// DefaultHistogramBuckets are upper bounds used when a histogram is created from a single observation.
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramValue is a value of histogram metric.
+// Counts has one more element than Bounds, the last one counts observations above the highest bound.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"` // верхние границы бакетов по возрастанию
+	Counts []uint64  `json:"counts"` // количество наблюдений в каждом бакете
+	Sum    float64   `json:"sum"`    // сумма всех наблюдений
+}
+
+// NewHistogram returns empty HistogramValue with given bucket bounds.
+func NewHistogram(bounds []float64) *HistogramValue {
+	h := HistogramValue{
+		Bounds: make([]float64, len(bounds)),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+	copy(h.Bounds, bounds)
+
+	return &h
+}
+
+// Observe adds value to the matching bucket.
+func (h *HistogramValue) Observe(value float64) {
+	idx := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[idx]++
+	h.Sum += value
+}
+
+// Count returns total number of observations.
+func (h *HistogramValue) Count() uint64 {
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+
+	return count
+}
+
+// Validate returns apierror.InvalidValue if bounds are not strictly increasing or counts length doesn't match bounds.
+func (h *HistogramValue) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return apierror.InvalidValue
+	}
+
+	for i := 1; i < len(h.Bounds); i++ {
+		if h.Bounds[i] <= h.Bounds[i-1] {
+			return apierror.InvalidValue
+		}
+	}
+
+	return nil
+}
+
+// Copy returns deep copy of HistogramValue.
+func (h *HistogramValue) Copy() *HistogramValue {
+	result := HistogramValue{
+		Bounds: make([]float64, len(h.Bounds)),
+		Counts: make([]uint64, len(h.Counts)),
+		Sum:    h.Sum,
+	}
+	copy(result.Bounds, h.Bounds)
+	copy(result.Counts, h.Counts)
+
+	return &result
+}
+
+// Merge returns new HistogramValue with counts and sum of both histograms.
+// If bucket bounds are different, apierror.BucketsMismatch is returned.
+func (h *HistogramValue) Merge(other *HistogramValue) (*HistogramValue, error) {
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return nil, apierror.BucketsMismatch
+	}
+
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return nil, apierror.BucketsMismatch
+		}
+	}
+
+	result := h.Copy()
+	for i := range other.Counts {
+		result.Counts[i] += other.Counts[i]
+	}
+	result.Sum += other.Sum
+
+	return result, nil
+}
+
+// String returns histogram representation which is used as HMAC input.
+func (h *HistogramValue) String() string {
+	bounds := make([]string, len(h.Bounds))
+	for i, bound := range h.Bounds {
+		bounds[i] = fmt.Sprintf("%f", bound)
+	}
+
+	counts := make([]string, len(h.Counts))
+	for i, count := range h.Counts {
+		counts[i] = fmt.Sprintf("%d", count)
+	}
+
+	return fmt.Sprintf("%s:%s:%f", strings.Join(bounds, ","), strings.Join(counts, ","), h.Sum)
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/server/apierror"
+)
+
+func TestHistogramValue_Observe(t *testing.T) {
+	h := NewHistogram([]float64{1, 5, 10})
+
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(7)
+	h.Observe(100)
+
+	assert.Equal(t, []uint64{2, 0, 1, 1}, h.Counts)
+	assert.Equal(t, 108.5, h.Sum)
+	assert.Equal(t, uint64(4), h.Count())
+}
+
+func TestHistogramValue_Merge(t *testing.T) {
+	tests := []struct {
+		name  string
+		first HistogramValue
+		other HistogramValue
+		want  *HistogramValue
+		err   error
+	}{
+		{
+			name:  "Same bounds",
+			first: HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 2, 3}, Sum: 10},
+			other: HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 1}, Sum: 5},
+			want:  &HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{2, 2, 4}, Sum: 15},
+		},
+		{
+			name:  "Different bounds",
+			first: HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 2, 3}},
+			other: HistogramValue{Bounds: []float64{1, 3}, Counts: []uint64{1, 0, 1}},
+			err:   apierror.BucketsMismatch,
+		},
+		{
+			name:  "Different bounds count",
+			first: HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 2, 3}},
+			other: HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 0}},
+			err:   apierror.BucketsMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.first.Merge(&tt.other)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHistogramValue_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram HistogramValue
+		err       error
+	}{
+		{
+			name:      "Valid",
+			histogram: HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{0, 0, 0}},
+		},
+		{
+			name:      "Counts length mismatch",
+			histogram: HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{0, 0}},
+			err:       apierror.InvalidValue,
+		},
+		{
+			name:      "Unsorted bounds",
+			histogram: HistogramValue{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}},
+			err:       apierror.InvalidValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, tt.histogram.Validate())
+		})
+	}
+}
+
+func TestMetric_HashValueHistogram(t *testing.T) {
+	metric := Metric{
+		Name:      "Latency",
+		MType:     Histogram,
+		Histogram: &HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 3},
+	}
+
+	hash := metric.HashValue("key")
+	require.NotEmpty(t, hash)
+
+	metric.Histogram.Counts[1] = 3
+	assert.NotEqual(t, hash, metric.HashValue("key"))
+}
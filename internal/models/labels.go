@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go-metricscol/internal/server/apierror"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels is a set of key/value pairs which is a part of metric identity.
+type Labels map[string]string
+
+// ParseLabels parses labels from string in format "key=value,key2=value2".
+func ParseLabels(input string) (Labels, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+
+	labels := Labels{}
+	for _, pair := range strings.Split(input, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, apierror.InvalidLabels
+		}
+
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// Validate returns apierror.InvalidLabels if any label name is not a valid identifier
+// or any label value is not a valid UTF-8 string.
+func (l Labels) Validate() error {
+	for name, value := range l {
+		if !labelNameRegexp.MatchString(name) || !utf8.ValidString(value) {
+			return apierror.InvalidLabels
+		}
+	}
+
+	return nil
+}
+
+// String returns canonical representation of labels sorted by name, e.g. {host="a",region="b"}.
+// Empty string is returned for empty labels, so keys and hashes of metrics without labels are kept.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := strings.Builder{}
+	result.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			result.WriteString(",")
+		}
+		result.WriteString(name)
+		result.WriteString("=")
+		result.WriteString(strconv.Quote(l[name]))
+	}
+	result.WriteString("}")
+
+	return result.String()
+}
+
+// Copy returns copy of labels.
+func (l Labels) Copy() Labels {
+	if l == nil {
+		return nil
+	}
+
+	result := make(Labels, len(l))
+	for name, value := range l {
+		result[name] = value
+	}
+
+	return result
+}
+
+// Scan overrides logic of scanning Labels in database.
+func (l *Labels) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("can't convert %T to labels", src)
+	}
+
+	var labels Labels
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+
+	if len(labels) == 0 {
+		labels = nil
+	}
+	*l = labels
+
+	return nil
+}
+
+// Value overrides logic of storing Labels in database.
+func (l Labels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "{}", nil
+	}
+
+	labelsJSON, err := json.Marshal(map[string]string(l))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(labelsJSON), nil
+}
+
+// MatchType is type of comparison done by LabelMatcher.
+type MatchType string
+
+// Declaration of the supported label match types.
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher selects metrics by value of the label.
+// Missing label is matched as an empty string.
+type LabelMatcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewLabelMatcher returns new LabelMatcher.
+// Regular expressions are anchored at both ends.
+func NewLabelMatcher(matchType MatchType, name string, value string) (*LabelMatcher, error) {
+	matcher := LabelMatcher{Name: name, Type: matchType, Value: value}
+
+	switch matchType {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, apierror.InvalidLabels
+		}
+		matcher.re = re
+	default:
+		return nil, apierror.InvalidLabels
+	}
+
+	if !labelNameRegexp.MatchString(name) {
+		return nil, apierror.InvalidLabels
+	}
+
+	return &matcher, nil
+}
+
+// Matches returns true if labels satisfy the matcher.
+func (m *LabelMatcher) Matches(labels Labels) bool {
+	value := labels[m.Name]
+
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+
+	return false
+}
+
+// MatchLabels returns true if labels satisfy all matchers.
+func MatchLabels(labels Labels, matchers []LabelMatcher) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseLabelMatchers parses matchers from string in format `host="a",region=~"eu-.*"`.
+func ParseLabelMatchers(input string) ([]LabelMatcher, error) {
+	input = strings.TrimSpace(input)
+	input = strings.TrimPrefix(input, "{")
+	input = strings.TrimSuffix(input, "}")
+
+	matchers := make([]LabelMatcher, 0)
+	for len(strings.TrimSpace(input)) != 0 {
+		input = strings.TrimLeft(input, " ,")
+
+		opIdx := strings.IndexAny(input, "=!")
+		if opIdx <= 0 {
+			return nil, apierror.InvalidLabels
+		}
+		name := strings.TrimSpace(input[:opIdx])
+		input = input[opIdx:]
+
+		var matchType MatchType
+		for _, t := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+			if strings.HasPrefix(input, string(t)) {
+				matchType = t
+				break
+			}
+		}
+		if len(matchType) == 0 {
+			return nil, apierror.InvalidLabels
+		}
+		input = strings.TrimSpace(input[len(matchType):])
+
+		quoted, err := strconv.QuotedPrefix(input)
+		if err != nil {
+			return nil, apierror.InvalidLabels
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, apierror.InvalidLabels
+		}
+		input = strings.TrimSpace(input[len(quoted):])
+		if len(input) != 0 && input[0] != ',' {
+			return nil, apierror.InvalidLabels
+		}
+
+		matcher, err := NewLabelMatcher(matchType, name, value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, *matcher)
+	}
+
+	return matchers, nil
+}
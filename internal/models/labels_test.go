@@ -0,0 +1,157 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/server/apierror"
+)
+
+func TestLabels_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels Labels
+		want   string
+	}{
+		{
+			name:   "Empty labels",
+			labels: nil,
+			want:   "",
+		},
+		{
+			name:   "Sorted by name",
+			labels: Labels{"region": "eu", "host": "web1"},
+			want:   `{host="web1",region="eu"}`,
+		},
+		{
+			name:   "Quoted value",
+			labels: Labels{"path": `a"b`},
+			want:   `{path="a\"b"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.labels.String())
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Labels
+		err   error
+	}{
+		{
+			name:  "Empty",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "Multiple labels",
+			input: "host=web1, region=eu",
+			want:  Labels{"host": "web1", "region": "eu"},
+		},
+		{
+			name:  "Without value",
+			input: "host",
+			err:   apierror.InvalidLabels,
+		},
+		{
+			name:  "Invalid name",
+			input: "1host=web1",
+			err:   apierror.InvalidLabels,
+		},
+		{
+			name:  "Invalid UTF-8 value",
+			input: "host=web\xff",
+			err:   apierror.InvalidLabels,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabels(tt.input)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLabelMatchers(t *testing.T) {
+	labels := Labels{"host": "web1", "region": "eu-west"}
+
+	tests := []struct {
+		name    string
+		input   string
+		matches bool
+		err     error
+	}{
+		{
+			name:    "Empty",
+			input:   "",
+			matches: true,
+		},
+		{
+			name:    "Equal",
+			input:   `{host="web1"}`,
+			matches: true,
+		},
+		{
+			name:    "Not equal",
+			input:   `host!="web1"`,
+			matches: false,
+		},
+		{
+			name:    "Regexp",
+			input:   `host="web1", region=~"eu-.*"`,
+			matches: true,
+		},
+		{
+			name:    "Regexp is anchored",
+			input:   `region=~"eu"`,
+			matches: false,
+		},
+		{
+			name:    "Not regexp on missing label",
+			input:   `dc!~"a.*"`,
+			matches: true,
+		},
+		{
+			name:  "Unquoted value",
+			input: `host=web1`,
+			err:   apierror.InvalidLabels,
+		},
+		{
+			name:  "Invalid regexp",
+			input: `host=~"("`,
+			err:   apierror.InvalidLabels,
+		},
+		{
+			name:  "Missing separator",
+			input: `host="web1"region="eu"`,
+			err:   apierror.InvalidLabels,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers, err := ParseLabelMatchers(tt.input)
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				require.NotNil(t, matchers)
+				assert.Equal(t, tt.matches, MatchLabels(labels, matchers))
+			}
+		})
+	}
+}
+
+func TestMetric_HashValueLabels(t *testing.T) {
+	value := 1.0
+	metric := Metric{Name: "Alloc", MType: Gauge, Value: &value}
+	withoutLabels := metric.HashValue("key")
+
+	metric.Labels = Labels{"host": "web1"}
+	assert.NotEqual(t, withoutLabels, metric.HashValue("key"))
+}
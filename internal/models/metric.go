@@ -2,20 +2,30 @@ package models
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql/driver"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 )
 
+// nonceSize is size of random nonce in bytes.
+const nonceSize = 16
+
+// BodyHashHeader is a header with HMAC-SHA256 of the whole request body, see HashBody.
+const BodyHashHeader = "HashSHA256"
+
 // MetricType is type describing type of metric.
 type MetricType string
 
 // Declaration of the metric types used.
 const (
-	Gauge   MetricType = "gauge"
-	Counter MetricType = "counter"
+	Gauge     MetricType = "gauge"
+	Counter   MetricType = "counter"
+	Histogram MetricType = "histogram"
 )
 
 // String returns string representation.
@@ -25,6 +35,8 @@ func (m MetricType) String() string {
 		return "gauge"
 	case Counter:
 		return "counter"
+	case Histogram:
+		return "histogram"
 	}
 	return ""
 }
@@ -41,6 +53,8 @@ func (m *MetricType) Scan(src any) error {
 		*m = Gauge
 	case Counter.String():
 		*m = Counter
+	case Histogram.String():
+		*m = Histogram
 	default:
 		return fmt.Errorf("unknown metric type %s", src)
 	}
@@ -58,6 +72,8 @@ func (m *MetricType) IntGrpc() int {
 		return 2
 	case Counter:
 		return 1
+	case Histogram:
+		return 3
 	}
 
 	return 0
@@ -65,11 +81,15 @@ func (m *MetricType) IntGrpc() int {
 
 // Metric is a description of metric entity.
 type Metric struct {
-	Name  string     `json:"id"`              // имя метрики
-	MType MetricType `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64     `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64   `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	Hash  string     `json:"hash,omitempty"`  // значение хеш-функции
+	Name      string          `json:"id"`                  // имя метрики
+	MType     MetricType      `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+	Delta     *int64          `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64        `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *HistogramValue `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Labels    Labels          `json:"labels,omitempty"`    // метки, входящие в идентификатор метрики
+	Timestamp int64           `json:"timestamp,omitempty"` // время подписи метрики в секундах Unix
+	Nonce     string          `json:"nonce,omitempty"`     // случайное значение, не повторяющееся между подписями
+	Hash      string          `json:"hash,omitempty"`      // значение хеш-функции
 }
 
 // StringValue returns metric value in string.
@@ -79,13 +99,26 @@ func (m *Metric) StringValue() string {
 		return strconv.FormatFloat(*m.Value, 'g', -1, 64)
 	case Counter:
 		return strconv.FormatInt(*m.Delta, 10)
+	case Histogram:
+		if m.Histogram == nil {
+			return ""
+		}
+
+		histogramJSON, err := json.Marshal(m.Histogram)
+		if err != nil {
+			return ""
+		}
+		return string(histogramJSON)
 	}
 
 	// TODO: Добавить более строгое ограничение
 	return ""
 }
 
-// HashValue returns hash of metric based on name, type and value.
+// HashValue returns hash of metric based on name, labels, type and value.
+// Labels are written right after the name in canonical form, see Labels.String.
+// Histogram value is hashed as its bounds, counts and sum, see HistogramValue.String.
+// If metric is signed with timestamp and nonce, they are appended to the hashed string, so signed metric can't be replayed.
 func (m *Metric) HashValue(id string) string {
 	if len(id) == 0 {
 		return ""
@@ -93,15 +126,57 @@ func (m *Metric) HashValue(id string) string {
 
 	h := hmac.New(sha256.New, []byte(id))
 	var str string
+	name := m.Name + m.Labels.String()
 	switch m.MType {
 	case Counter:
-		str = fmt.Sprintf("%s:counter:%d", m.Name, *m.Delta)
+		str = fmt.Sprintf("%s:counter:%d", name, *m.Delta)
 	case Gauge:
-		str = fmt.Sprintf("%s:gauge:%f", m.Name, *m.Value)
+		str = fmt.Sprintf("%s:gauge:%f", name, *m.Value)
+	case Histogram:
+		if m.Histogram == nil {
+			return ""
+		}
+		str = fmt.Sprintf("%s:histogram:%s", name, m.Histogram.String())
 	default:
 		return ""
 	}
 
+	if m.Timestamp != 0 || len(m.Nonce) != 0 {
+		str = fmt.Sprintf("%s:%d:%s", str, m.Timestamp, m.Nonce)
+	}
+
 	h.Write([]byte(str))
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// Sign sets timestamp and random nonce of the metric and calculates its hash with the given key.
+// If key is empty, metric isn't signed.
+func (m *Metric) Sign(id string, now time.Time) error {
+	if len(id) == 0 {
+		m.Timestamp, m.Nonce, m.Hash = 0, "", ""
+		return nil
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("couldn't generate nonce: %s", err)
+	}
+
+	m.Timestamp = now.Unix()
+	m.Nonce = hex.EncodeToString(nonce)
+	m.Hash = m.HashValue(id)
+
+	return nil
+}
+
+// HashBody returns HMAC-SHA256 of the raw request body, so batch of metrics is signed as a unit
+// and metrics can't be dropped from it or reordered. If key is empty, empty string is returned.
+func HashBody(id string, body []byte) string {
+	if len(id) == 0 {
+		return ""
+	}
+
+	h := hmac.New(sha256.New, []byte(id))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
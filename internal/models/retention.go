@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionWindow describes how long samples of given resolution are kept.
+// Zero resolution means raw samples, otherwise only the last sample of every interval is kept.
+type RetentionWindow struct {
+	Resolution time.Duration
+	Period     time.Duration
+}
+
+// Retention is a list of windows sorted by period, e.g. raw samples for 24h, 1m rollups for 30 days.
+// Sample falls into the first window which period is longer than its age.
+// Samples older than period of the last window are deleted.
+// Empty Retention keeps all samples.
+type Retention []RetentionWindow
+
+// ParseRetention parses retention from string in format "raw:24h,1m:720h,1h:8760h".
+func ParseRetention(input string) (Retention, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+
+	var result Retention
+	for _, window := range strings.Split(input, ",") {
+		resolution, period, found := strings.Cut(strings.TrimSpace(window), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid retention window %q", window)
+		}
+
+		var parsed RetentionWindow
+		if resolution != "raw" {
+			var err error
+			parsed.Resolution, err = time.ParseDuration(resolution)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retention resolution %q: %s", resolution, err)
+			}
+		}
+
+		var err error
+		parsed.Period, err = time.ParseDuration(period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention period %q: %s", period, err)
+		}
+
+		result = append(result, parsed)
+	}
+
+	if err := result.Validate(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Validate returns error if periods are not strictly increasing or resolutions are decreasing.
+func (r Retention) Validate() error {
+	for i, window := range r {
+		if window.Resolution < 0 || window.Period <= 0 {
+			return fmt.Errorf("retention window %d must have positive period and non-negative resolution", i)
+		}
+
+		if i > 0 && (window.Period <= r[i-1].Period || window.Resolution < r[i-1].Resolution) {
+			return fmt.Errorf("retention windows must be sorted by period and resolution")
+		}
+	}
+
+	return nil
+}
+
+// Downsample returns samples which are kept by retention at the moment now.
+// Samples must be sorted by timestamp.
+func (r Retention) Downsample(samples []Sample, now time.Time) []Sample {
+	if len(r) == 0 {
+		return samples
+	}
+
+	result := make([]Sample, 0, len(samples))
+	for i, sample := range samples {
+		window, ok := r.window(now.Sub(sample.Timestamp))
+		if !ok {
+			continue
+		}
+
+		if window.Resolution != 0 && i+1 < len(samples) {
+			next := samples[i+1]
+			nextWindow, ok := r.window(now.Sub(next.Timestamp))
+			if ok && nextWindow == window && sample.Timestamp.Truncate(window.Resolution).Equal(next.Timestamp.Truncate(window.Resolution)) {
+				continue
+			}
+		}
+
+		result = append(result, sample)
+	}
+
+	return result
+}
+
+// window returns window the sample of given age falls into.
+// If sample is expired, false is returned.
+func (r Retention) window(age time.Duration) (RetentionWindow, bool) {
+	for _, window := range r {
+		if age < window.Period {
+			return window, true
+		}
+	}
+
+	return RetentionWindow{}, false
+}
+
+func (r *Retention) String() string {
+	windows := make([]string, len(*r))
+	for i, window := range *r {
+		resolution := "raw"
+		if window.Resolution != 0 {
+			resolution = window.Resolution.String()
+		}
+		windows[i] = fmt.Sprintf("%s:%s", resolution, window.Period)
+	}
+
+	return strings.Join(windows, ",")
+}
+
+func (r *Retention) Set(value string) error {
+	retention, err := ParseRetention(value)
+	if err != nil {
+		return err
+	}
+
+	*r = retention
+	return nil
+}
+
+func (r *Retention) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	return r.Set(value)
+}
+
+func ParseRetentionFromEnv(v string) (interface{}, error) {
+	var parsedRetention Retention
+	if err := parsedRetention.Set(v); err != nil {
+		return nil, err
+	}
+
+	return parsedRetention, nil
+}
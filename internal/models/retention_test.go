@@ -0,0 +1,97 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/utils"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Retention
+		wantErr bool
+	}{
+		{
+			name:  "Empty",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "Raw and rollups",
+			input: "raw:24h, 1m:720h,1h:8760h",
+			want: Retention{
+				{Period: 24 * time.Hour},
+				{Resolution: time.Minute, Period: 720 * time.Hour},
+				{Resolution: time.Hour, Period: 8760 * time.Hour},
+			},
+		},
+		{
+			name:    "Without period",
+			input:   "raw",
+			wantErr: true,
+		},
+		{
+			name:    "Unsorted periods",
+			input:   "raw:24h,1m:1h",
+			wantErr: true,
+		},
+		{
+			name:    "Decreasing resolution",
+			input:   "1h:24h,1m:48h",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetention(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.input != "", len(got.String()) != 0)
+		})
+	}
+}
+
+func TestRetention_Downsample(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	retention := Retention{
+		{Period: time.Hour},
+		{Resolution: time.Minute, Period: 24 * time.Hour},
+	}
+
+	sample := func(ago time.Duration, value float64) Sample {
+		return Sample{Timestamp: now.Add(-ago), Value: utils.Ptr(value)}
+	}
+
+	samples := []Sample{
+		sample(48*time.Hour, 1),
+		sample(2*time.Hour+50*time.Second, 2),
+		sample(2*time.Hour+30*time.Second, 3),
+		sample(2*time.Hour+10*time.Second, 4),
+		sample(2*time.Hour, 5),
+		sample(30*time.Minute+20*time.Second, 6),
+		sample(30*time.Minute+10*time.Second, 7),
+	}
+
+	got := retention.Downsample(samples, now)
+
+	var values []float64
+	for _, s := range got {
+		values = append(values, *s.Value)
+	}
+	assert.Equal(t, []float64{4, 5, 6, 7}, values)
+
+	t.Run("Empty retention keeps samples", func(t *testing.T) {
+		assert.Equal(t, samples, Retention(nil).Downsample(samples, now))
+	})
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Sample is a value of the metric series at the moment of time.
+// Counter and histogram samples hold the accumulated value, not the increment.
+type Sample struct {
+	Timestamp time.Time       `json:"timestamp"`           // время записи значения
+	Value     *float64        `json:"value,omitempty"`     // значение метрики gauge
+	Delta     *int64          `json:"delta,omitempty"`     // значение метрики counter
+	Histogram *HistogramValue `json:"histogram,omitempty"` // значение метрики histogram
+}
+
+// NewSample returns Sample with the current value of the metric.
+func NewSample(metric Metric, timestamp time.Time) Sample {
+	return Sample{
+		Timestamp: timestamp,
+		Value:     metric.Value,
+		Delta:     metric.Delta,
+		Histogram: metric.Histogram,
+	}
+}
+
+// StringValue returns sample value in string.
+// Histogram value is not represented as string, empty string is returned instead.
+func (s *Sample) StringValue() string {
+	switch {
+	case s.Value != nil:
+		return strconv.FormatFloat(*s.Value, 'g', -1, 64)
+	case s.Delta != nil:
+		return strconv.FormatInt(*s.Delta, 10)
+	}
+
+	return ""
+}
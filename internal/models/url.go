@@ -9,9 +9,11 @@ import (
 )
 
 // GetURLData describes the parameters passed to the URL in the GET request.
+// Labels are passed as query parameters, e.g. /value/gauge/Alloc?host=a.
 type GetURLData struct {
 	MetricName string
 	MetricType MetricType
+	Labels     Labels
 }
 
 // PostURLData describes the parameters passed to the URL in the POST request.
@@ -49,6 +51,8 @@ func ParseGetURLData(r *http.Request) (*GetURLData, error) {
 		urlData.MetricType = Gauge
 	case "counter":
 		urlData.MetricType = Counter
+	case "histogram":
+		urlData.MetricType = Histogram
 	default:
 		return nil, apierror.UnknownMetricType
 	}
@@ -60,5 +64,17 @@ func ParseGetURLData(r *http.Request) (*GetURLData, error) {
 	}
 	urlData.MetricName = name
 
+	query := r.URL.Query()
+	if len(query) != 0 {
+		urlData.Labels = make(Labels, len(query))
+		for labelName := range query {
+			urlData.Labels[labelName] = query.Get(labelName)
+		}
+
+		if err := urlData.Labels.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	return &urlData, nil
 }
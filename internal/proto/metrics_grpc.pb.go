@@ -23,6 +23,7 @@ const (
 	Metrics_UpdatesMetric_FullMethodName = "/proto.Metrics/UpdatesMetric"
 	Metrics_ValueMetric_FullMethodName   = "/proto.Metrics/ValueMetric"
 	Metrics_ListMetrics_FullMethodName   = "/proto.Metrics/ListMetrics"
+	Metrics_RangeMetric_FullMethodName   = "/proto.Metrics/RangeMetric"
 )
 
 // MetricsClient is the client API for Metrics service.
@@ -33,6 +34,7 @@ type MetricsClient interface {
 	UpdatesMetric(ctx context.Context, in *UpdatesRequest, opts ...grpc.CallOption) (*UpdatesResponse, error)
 	ValueMetric(ctx context.Context, in *ValueRequest, opts ...grpc.CallOption) (*ValueResponse, error)
 	ListMetrics(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	RangeMetric(ctx context.Context, in *RangeRequest, opts ...grpc.CallOption) (*RangeResponse, error)
 }
 
 type metricsClient struct {
@@ -79,6 +81,15 @@ func (c *metricsClient) ListMetrics(ctx context.Context, in *ListRequest, opts .
 	return out, nil
 }
 
+func (c *metricsClient) RangeMetric(ctx context.Context, in *RangeRequest, opts ...grpc.CallOption) (*RangeResponse, error) {
+	out := new(RangeResponse)
+	err := c.cc.Invoke(ctx, Metrics_RangeMetric_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility
@@ -87,6 +98,7 @@ type MetricsServer interface {
 	UpdatesMetric(context.Context, *UpdatesRequest) (*UpdatesResponse, error)
 	ValueMetric(context.Context, *ValueRequest) (*ValueResponse, error)
 	ListMetrics(context.Context, *ListRequest) (*ListResponse, error)
+	RangeMetric(context.Context, *RangeRequest) (*RangeResponse, error)
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -106,6 +118,9 @@ func (UnimplementedMetricsServer) ValueMetric(context.Context, *ValueRequest) (*
 func (UnimplementedMetricsServer) ListMetrics(context.Context, *ListRequest) (*ListResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
 }
+func (UnimplementedMetricsServer) RangeMetric(context.Context, *RangeRequest) (*RangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RangeMetric not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 
 // UnsafeMetricsServer may be embedded to opt out of forward compatibility for this service.
@@ -191,6 +206,24 @@ func _Metrics_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_RangeMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).RangeMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Metrics_RangeMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).RangeMetric(ctx, req.(*RangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -214,6 +247,10 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListMetrics",
 			Handler:    _Metrics_ListMetrics_Handler,
 		},
+		{
+			MethodName: "RangeMetric",
+			Handler:    _Metrics_RangeMetric_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/metrics.proto",
@@ -3,6 +3,8 @@ package proto
 import (
 	"strconv"
 
+	"google.golang.org/protobuf/types/known/timestamppb"
+
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/server/apierror"
 )
@@ -11,7 +13,12 @@ func ParseMetricFromRequest(metric *Metric) (*models.Metric, error) {
 	var resultMetric models.Metric
 
 	resultMetric.Name = metric.Name
+	resultMetric.Timestamp = metric.Timestamp
+	resultMetric.Nonce = metric.Nonce
 	resultMetric.Hash = metric.Hash
+	if len(metric.Labels) != 0 {
+		resultMetric.Labels = metric.Labels
+	}
 	switch metric.Type {
 	case MetricType_GAUGE:
 		resultMetric.MType = models.Gauge
@@ -31,6 +38,18 @@ func ParseMetricFromRequest(metric *Metric) (*models.Metric, error) {
 		}
 
 		resultMetric.Delta = &intVal
+	case MetricType_HISTOGRAM:
+		resultMetric.MType = models.Histogram
+
+		if metric.Histogram == nil {
+			return nil, apierror.InvalidValue
+		}
+
+		resultMetric.Histogram = &models.HistogramValue{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Sum:    metric.Histogram.Sum,
+		}
 	default:
 		return nil, apierror.UnknownMetricType
 	}
@@ -38,13 +57,88 @@ func ParseMetricFromRequest(metric *Metric) (*models.Metric, error) {
 	return &resultMetric, nil
 }
 
+// NewMetric converts models.Metric to its protobuf representation with hash calculated using hashKey.
+func NewMetric(metric models.Metric, hashKey string) *Metric {
+	result := Metric{
+		Name:      metric.Name,
+		Type:      MetricType(metric.MType.IntGrpc()),
+		Value:     metric.StringValue(),
+		Timestamp: metric.Timestamp,
+		Nonce:     metric.Nonce,
+		Hash:      metric.HashValue(hashKey),
+	}
+
+	if len(metric.Labels) != 0 {
+		result.Labels = metric.Labels
+	}
+
+	if metric.MType == models.Histogram && metric.Histogram != nil {
+		result.Value = ""
+		result.Histogram = &Histogram{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Sum:    metric.Histogram.Sum,
+		}
+	}
+
+	return &result
+}
+
+// NewSample converts models.Sample to its protobuf representation.
+func NewSample(sample models.Sample) *Sample {
+	result := Sample{
+		Timestamp: timestamppb.New(sample.Timestamp),
+		Value:     sample.StringValue(),
+	}
+
+	if sample.Histogram != nil {
+		result.Histogram = &Histogram{
+			Bounds: sample.Histogram.Bounds,
+			Counts: sample.Histogram.Counts,
+			Sum:    sample.Histogram.Sum,
+		}
+	}
+
+	return &result
+}
+
 func ParseTypeFromRequest(metricType MetricType) (models.MetricType, error) {
 	switch metricType {
 	case MetricType_GAUGE:
 		return models.Gauge, nil
 	case MetricType_COUNTER:
 		return models.Counter, nil
+	case MetricType_HISTOGRAM:
+		return models.Histogram, nil
 	default:
 		return "", apierror.UnknownMetricType
 	}
 }
+
+// ParseLabelMatchersFromRequest converts protobuf label matchers to models.LabelMatcher.
+func ParseLabelMatchersFromRequest(matchers []*LabelMatcher) ([]models.LabelMatcher, error) {
+	result := make([]models.LabelMatcher, 0, len(matchers))
+	for _, matcher := range matchers {
+		var matchType models.MatchType
+		switch matcher.Type {
+		case MatchType_EQUAL:
+			matchType = models.MatchEqual
+		case MatchType_NOT_EQUAL:
+			matchType = models.MatchNotEqual
+		case MatchType_REGEXP:
+			matchType = models.MatchRegexp
+		case MatchType_NOT_REGEXP:
+			matchType = models.MatchNotRegexp
+		default:
+			return nil, apierror.InvalidLabels
+		}
+
+		labelMatcher, err := models.NewLabelMatcher(matchType, matcher.Name, matcher.Value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *labelMatcher)
+	}
+
+	return result, nil
+}
@@ -3,24 +3,111 @@ package memory
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
+	"sync"
+	"time"
 
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/tenant"
 )
 
 // MemStorage is a metrics in-memory storage which implements Repository interface.
+// Every tenant has a separate keyspace, tenant is taken from context, see tenant.FromContext.
 type MemStorage struct {
+	keyspaces map[string]*keyspace
+	// mu serializes writes, so samples in history follow the order of updates.
+	mu sync.RWMutex
+
+	// generations is the number of previous store files kept by SaveToDisk, see KeepGenerations.
+	generations int
+	// saveMu serializes saving to disk, so concurrent saves don't rotate generations at the same time.
+	saveMu sync.Mutex
+}
+
+// keyspace holds metrics and their history of a single tenant.
+type keyspace struct {
 	metrics Metrics
+	history map[string][]models.Sample
+}
+
+func newKeyspace() *keyspace {
+	return &keyspace{metrics: NewMetrics(), history: map[string][]models.Sample{}}
+}
+
+// snapshot is a format of the file MemStorage is saved to.
+// Keyspace of the default tenant is stored at the top level, so files saved before tenants were introduced are still read.
+type snapshot struct {
+	Metrics map[string]models.Metric   `json:"metrics"`
+	History map[string][]models.Sample `json:"history"`
+	Tenants map[string]snapshot        `json:"tenants,omitempty"`
+}
+
+// keyspace returns keyspace of the tenant stored in context.
+// If create is false and tenant has no keyspace yet, nil is returned. Must be called with mu held.
+func (memStorage *MemStorage) keyspace(ctx context.Context, create bool) *keyspace {
+	name := tenant.FromContext(ctx)
+
+	space, ok := memStorage.keyspaces[name]
+	if !ok && create {
+		space = newKeyspace()
+		memStorage.keyspaces[name] = space
+	}
+
+	return space
 }
 
 func (memStorage *MemStorage) Ping(_ context.Context) error {
 	return nil
 }
 
+// KeepGenerations sets the number of previous store files kept by SaveToDisk next to the store file.
+func (memStorage *MemStorage) KeepGenerations(generations int) {
+	memStorage.generations = generations
+}
+
+// generationPath returns path of the store file of generation, 0 is the latest one.
+func generationPath(filePath string, generation int) string {
+	if generation == 0 {
+		return filePath
+	}
+
+	return fmt.Sprintf("%s.%d", filePath, generation)
+}
+
+// RestoreFromDisk restores metrics from filePath.
+// If it's missing or corrupt, metrics are restored from the newest valid previous generation kept by SaveToDisk.
 func (memStorage *MemStorage) RestoreFromDisk(filePath string) error {
+	var firstErr error
+	for generation := 0; generation <= memStorage.generations; generation++ {
+		path := generationPath(filePath, generation)
+
+		err := memStorage.restoreFile(path)
+		if err == nil {
+			if generation > 0 {
+				log.Printf("Restored metrics from previous generation %s, %s is invalid: %s", path, filePath, firstErr)
+			}
+			return nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !os.IsNotExist(err) {
+			log.Printf("Couldn't restore metrics from %s with error: %s", path, err)
+		}
+	}
+
+	return firstErr
+}
+
+// restoreFile restores metrics from a single file, storage isn't changed if the file is invalid.
+func (memStorage *MemStorage) restoreFile(filePath string) error {
 	file, err := os.OpenFile(filePath, os.O_RDONLY|os.O_SYNC, 0777)
 	if err != nil {
 		return err
@@ -28,29 +115,161 @@ func (memStorage *MemStorage) RestoreFromDisk(filePath string) error {
 
 	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&memStorage.metrics.Collection); err != nil {
+	var raw json.RawMessage
+	if err := json.NewDecoder(file).Decode(&raw); err != nil {
+		return err
+	}
+
+	var saved snapshot
+	if err := json.Unmarshal(raw, &saved); err != nil {
 		return err
 	}
 
+	// Files saved before history was introduced contain only the metrics collection.
+	// It's decoded separately, so storage isn't changed if decoding fails.
+	var legacy map[string]models.Metric
+	if saved.Metrics == nil {
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return err
+		}
+	}
+
+	memStorage.mu.Lock()
+	defer memStorage.mu.Unlock()
+
+	defaultKeyspace := memStorage.keyspaces[tenant.Default]
+	if saved.Metrics == nil {
+		for key, metric := range legacy {
+			defaultKeyspace.metrics.Collection[key] = metric
+		}
+		return nil
+	}
+
+	defaultKeyspace.restore(saved)
+	for name, tenantSnapshot := range saved.Tenants {
+		space := newKeyspace()
+		space.restore(tenantSnapshot)
+		memStorage.keyspaces[name] = space
+	}
+
 	return nil
 }
 
+func (space *keyspace) restore(saved snapshot) {
+	if saved.Metrics != nil {
+		space.metrics.Collection = saved.Metrics
+	}
+	if saved.History != nil {
+		space.history = saved.History
+	}
+}
+
+// SaveToDisk writes metrics to a temporary file next to filePath, syncs it and renames it over filePath,
+// so a crash during saving never leaves a truncated store file behind.
+// The replaced file is kept as filePath.1, older ones are shifted up to the number of generations.
 func (memStorage *MemStorage) SaveToDisk(filePath string) error {
 	log.Printf("saving to disk")
 
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
+	memStorage.saveMu.Lock()
+	defer memStorage.saveMu.Unlock()
+
+	data, err := memStorage.encode()
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
+	dir := filepath.Dir(filePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(memStorage.metrics.Collection); err != nil {
+	if err := writeFile(tmp, data); err != nil {
+		os.Remove(tmpPath)
 		return err
 	}
 
+	if err := memStorage.rotate(filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// encode returns JSON snapshot of all keyspaces.
+func (memStorage *MemStorage) encode() ([]byte, error) {
+	memStorage.mu.Lock()
+	defer memStorage.mu.Unlock()
+
+	var saved snapshot
+	for name, space := range memStorage.keyspaces {
+		spaceSnapshot := snapshot{Metrics: space.metrics.Collection, History: space.history}
+		if name == tenant.Default {
+			saved.Metrics, saved.History = spaceSnapshot.Metrics, spaceSnapshot.History
+			continue
+		}
+
+		if saved.Tenants == nil {
+			saved.Tenants = make(map[string]snapshot)
+		}
+		saved.Tenants[name] = spaceSnapshot
+	}
+
+	return json.Marshal(saved)
+}
+
+// writeFile writes data to file, syncs and closes it.
+func writeFile(file *os.File, data []byte) error {
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't write store file: %s", err)
+	}
+
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't change mode of store file: %s", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't sync store file: %s", err)
+	}
+
+	return file.Close()
+}
+
+// rotate shifts previous generations of filePath by one, the oldest one is overwritten.
+// filePath itself becomes filePath.1, so it must be replaced right after.
+func (memStorage *MemStorage) rotate(filePath string) error {
+	for generation := memStorage.generations; generation > 0; generation-- {
+		err := os.Rename(generationPath(filePath, generation-1), generationPath(filePath, generation))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("couldn't rotate store file: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// syncDir syncs directory, so renames of files in it survive a crash.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("couldn't sync store directory: %s", err)
+	}
+
 	return nil
 }
 
@@ -58,50 +277,214 @@ func (memStorage *MemStorage) SupportsSavingToDisk() bool {
 	return true
 }
 
+// SupportsTx returns true as batch updates are applied at once or not at all, see Metrics.Updates.
 func (memStorage *MemStorage) SupportsTx() bool {
-	return false
+	return true
 }
 
-func (memStorage *MemStorage) Updates(_ context.Context, metrics []models.Metric) error {
-	for _, metric := range metrics {
-		err := memStorage.metrics.UpdateWithStruct(&metric)
-		if err != nil {
-			return err
+func (memStorage *MemStorage) Updates(ctx context.Context, metrics []models.Metric) error {
+	return memStorage.updates(ctx, metrics, false)
+}
+
+func (memStorage *MemStorage) UpdatesPartial(ctx context.Context, metrics []models.Metric) error {
+	return memStorage.updates(ctx, metrics, true)
+}
+
+// updates applies batch with Metrics.Updates or Metrics.UpdatesPartial and appends samples of updated series.
+func (memStorage *MemStorage) updates(ctx context.Context, metrics []models.Metric, partial bool) error {
+	memStorage.mu.Lock()
+	defer memStorage.mu.Unlock()
+
+	space := memStorage.keyspace(ctx, true)
+
+	var err error
+	if partial {
+		err = space.metrics.UpdatesPartial(metrics)
+	} else {
+		err = space.metrics.Updates(metrics)
+	}
+
+	var batchError *apierror.BatchError
+	if err != nil && !errors.As(err, &batchError) {
+		return err
+	}
+
+	skipped := make(map[int]struct{})
+	if batchError != nil {
+		for _, item := range batchError.Items {
+			skipped[item.Index] = struct{}{}
+		}
+	}
+
+	// Batch is applied at once, so series updated several times get a single sample.
+	sampled := make(map[string]struct{}, len(metrics))
+	for i, metric := range metrics {
+		key := getKey(metric.Name, metric.MType, metric.Labels)
+		if _, ok := skipped[i]; ok {
+			continue
+		}
+		if _, ok := sampled[key]; ok {
+			continue
 		}
+
+		sampled[key] = struct{}{}
+		space.appendSample(metric.Name, metric.MType, metric.Labels)
 	}
 
+	return err
+}
+
+func (memStorage *MemStorage) UpdateWithStruct(ctx context.Context, metric *models.Metric) error {
+	memStorage.mu.Lock()
+	defer memStorage.mu.Unlock()
+
+	space := memStorage.keyspace(ctx, true)
+	if err := space.metrics.UpdateWithStruct(metric); err != nil {
+		return err
+	}
+
+	space.appendSample(metric.Name, metric.MType, metric.Labels)
 	return nil
 }
 
-func (memStorage *MemStorage) UpdateWithStruct(_ context.Context, metric *models.Metric) error {
-	return memStorage.metrics.UpdateWithStruct(metric)
+// appendSample writes current value of the series to its history.
+// Must be called with mu of MemStorage held.
+func (space *keyspace) appendSample(name string, valueType models.MetricType, labels models.Labels) {
+	metric, err := space.metrics.GetWithLabels(name, valueType, labels)
+	if err != nil {
+		return
+	}
+
+	key := getKey(name, valueType, labels)
+	space.history[key] = append(space.history[key], models.NewSample(*metric, time.Now().UTC().Round(0)))
 }
 
-func (memStorage *MemStorage) GetAll(context.Context) ([]models.Metric, error) {
-	all := memStorage.metrics.GetAll()
+func (memStorage *MemStorage) GetRange(ctx context.Context, name string, valueType models.MetricType, labels models.Labels, from time.Time, to time.Time) ([]models.Sample, error) {
+	memStorage.mu.RLock()
+	defer memStorage.mu.RUnlock()
 
-	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	result := make([]models.Sample, 0)
+
+	space := memStorage.keyspace(ctx, false)
+	if space == nil {
+		return result, nil
+	}
+
+	for _, sample := range space.history[getKey(name, valueType, labels)] {
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+
+	return result, nil
+}
+
+// Compact downsamples history of all tenants.
+func (memStorage *MemStorage) Compact(_ context.Context, retention models.Retention, now time.Time) error {
+	memStorage.mu.Lock()
+	defer memStorage.mu.Unlock()
+
+	for _, space := range memStorage.keyspaces {
+		for key, samples := range space.history {
+			kept := retention.Downsample(samples, now)
+			if len(kept) == 0 {
+				delete(space.history, key)
+				continue
+			}
+
+			space.history[key] = kept
+		}
+	}
+
+	return nil
+}
+
+func (memStorage *MemStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
+	memStorage.mu.RLock()
+	space := memStorage.keyspace(ctx, false)
+	memStorage.mu.RUnlock()
+
+	if space == nil {
+		return []models.Metric{}, nil
+	}
+
+	all := space.metrics.GetAll()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Labels.String() < all[j].Labels.String()
+	})
 
 	return all, nil
 }
 
-func (memStorage *MemStorage) Get(_ context.Context, key string, valueType models.MetricType) (*models.Metric, error) {
-	result, err := memStorage.metrics.Get(key, valueType)
+func (memStorage *MemStorage) Get(ctx context.Context, key string, valueType models.MetricType, labels models.Labels) (*models.Metric, error) {
+	memStorage.mu.RLock()
+	space := memStorage.keyspace(ctx, false)
+	memStorage.mu.RUnlock()
+
+	if space == nil {
+		return nil, apierror.NotFound
+	}
+
+	result, err := space.metrics.GetWithLabels(key, valueType, labels)
 	return result, err
 }
 
-func (memStorage *MemStorage) Update(_ context.Context, metric models.Metric) error {
+func (memStorage *MemStorage) CountSeries(ctx context.Context) (int, error) {
+	memStorage.mu.RLock()
+	space := memStorage.keyspace(ctx, false)
+	memStorage.mu.RUnlock()
+
+	if space == nil {
+		return 0, nil
+	}
+
+	return space.metrics.Len(), nil
+}
+
+func (memStorage *MemStorage) CountAllSeries(_ context.Context) (int, error) {
+	memStorage.mu.RLock()
+	defer memStorage.mu.RUnlock()
+
+	var count int
+	for _, space := range memStorage.keyspaces {
+		count += space.metrics.Len()
+	}
+
+	return count, nil
+}
+
+func (memStorage *MemStorage) Update(ctx context.Context, metric models.Metric) error {
+	memStorage.mu.Lock()
+	defer memStorage.mu.Unlock()
+
+	space := memStorage.keyspace(ctx, true)
+
+	var err error
 	switch metric.MType {
 	case models.Gauge:
 		// TODO: update signature
-		return memStorage.metrics.Update(metric.Name, models.Gauge, *metric.Value)
+		err = space.metrics.UpdateWithLabels(metric.Name, models.Gauge, metric.Labels, *metric.Value)
 	case models.Counter:
-		return memStorage.metrics.Update(metric.Name, models.Counter, *metric.Delta)
+		err = space.metrics.UpdateWithLabels(metric.Name, models.Counter, metric.Labels, *metric.Delta)
+	case models.Histogram:
+		err = space.metrics.UpdateWithLabels(metric.Name, models.Histogram, metric.Labels, metric.Histogram)
 	default:
 		return apierror.UnknownMetricType
 	}
+
+	if err != nil {
+		return err
+	}
+
+	space.appendSample(metric.Name, metric.MType, metric.Labels)
+	return nil
 }
 
 func NewMemStorage() *MemStorage {
-	return &MemStorage{metrics: NewMetrics()}
+	return &MemStorage{keyspaces: map[string]*keyspace{tenant.Default: newKeyspace()}}
 }
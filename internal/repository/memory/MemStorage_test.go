@@ -3,13 +3,17 @@ package memory
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository"
+	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/tenant"
 	"go-metricscol/internal/utils"
 )
 
@@ -67,6 +71,112 @@ func TestMemStorage_Updates(t *testing.T) {
 	repository.TestUpdates(context.Background(), t, storage)
 }
 
+func TestMemStorage_UpdatesPartial(t *testing.T) {
+	storage := NewMemStorage()
+
+	repository.TestUpdatesPartial(context.Background(), t, storage)
+}
+
+func TestMemStorage_GetRange(t *testing.T) {
+	storage := NewMemStorage()
+	from := time.Now()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, storage.Update(context.Background(), models.Metric{
+			Name:  "PollCount",
+			MType: models.Counter,
+			Delta: utils.Ptr(int64(1)),
+		}))
+	}
+
+	samples, err := storage.GetRange(context.Background(), "PollCount", models.Counter, nil, from, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	for i, sample := range samples {
+		assert.Equal(t, int64(i+1), *sample.Delta)
+	}
+
+	t.Run("Empty range", func(t *testing.T) {
+		samples, err := storage.GetRange(context.Background(), "PollCount", models.Counter, nil, from.Add(-time.Hour), from.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Empty(t, samples)
+	})
+
+	t.Run("Other labels", func(t *testing.T) {
+		samples, err := storage.GetRange(context.Background(), "PollCount", models.Counter, models.Labels{"host": "a"}, from, time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, samples)
+	})
+}
+
+func TestMemStorage_Compact(t *testing.T) {
+	storage := NewMemStorage()
+
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:  "Alloc",
+		MType: models.Gauge,
+		Value: utils.Ptr(1.0),
+	}))
+
+	retention := models.Retention{{Period: time.Hour}}
+
+	require.NoError(t, storage.Compact(context.Background(), retention, time.Now()))
+	samples, err := storage.GetRange(context.Background(), "Alloc", models.Gauge, nil, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, samples, 1)
+
+	require.NoError(t, storage.Compact(context.Background(), retention, time.Now().Add(2*time.Hour)))
+	samples, err = storage.GetRange(context.Background(), "Alloc", models.Gauge, nil, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	_, err = storage.Get(context.Background(), "Alloc", models.Gauge, nil)
+	assert.NoError(t, err, "compaction must not delete current value")
+}
+
+func TestMemStorage_Tenants(t *testing.T) {
+	storage := NewMemStorage()
+	teamA := tenant.NewContext(context.Background(), "team-a")
+
+	require.NoError(t, storage.Update(context.Background(), testMetric))
+	require.NoError(t, storage.Updates(teamA, []models.Metric{
+		{Name: "test", MType: models.Gauge, Value: utils.Ptr(float64(2))},
+		{Name: "other", MType: models.Counter, Delta: utils.Ptr(int64(1))},
+	}))
+
+	metric, err := storage.Get(context.Background(), "test", models.Gauge, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *metric.Value)
+
+	metric, err = storage.Get(teamA, "test", models.Gauge, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, *metric.Value)
+
+	_, err = storage.Get(tenant.NewContext(context.Background(), "team-b"), "test", models.Gauge, nil)
+	assert.ErrorIs(t, err, apierror.NotFound)
+
+	count, err := storage.CountSeries(teamA)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = storage.CountAllSeries(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	samples, err := storage.GetRange(teamA, "test", models.Gauge, nil, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, samples, 1)
+
+	t.Run("Save and restore", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		require.NoError(t, storage.SaveToDisk(path))
+
+		newStorage := NewMemStorage()
+		require.NoError(t, newStorage.RestoreFromDisk(path))
+		assert.Equal(t, storage, newStorage)
+	})
+}
+
 var testMetric = models.Metric{
 	Name:  "test",
 	MType: models.Gauge,
@@ -93,3 +203,95 @@ func TestMemStorage_SaveAndRestoreFromDisk(t *testing.T) {
 		assert.Equal(t, storage, newStorage)
 	})
 }
+
+func TestMemStorage_SaveToDiskGenerations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.json")
+
+	storage := NewMemStorage()
+	storage.KeepGenerations(2)
+
+	values := []float64{1, 2, 3, 4}
+	for _, value := range values {
+		metric := models.Metric{Name: "test", MType: models.Gauge, Value: utils.Ptr(value)}
+		require.NoError(t, storage.UpdateWithStruct(context.Background(), &metric))
+		require.NoError(t, storage.SaveToDisk(path))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{path, path + ".1", path + ".2"}, files)
+
+	restoredValue := func(t *testing.T, storage *MemStorage) float64 {
+		metric, err := storage.Get(context.Background(), "test", models.Gauge, nil)
+		require.NoError(t, err)
+		return *metric.Value
+	}
+
+	t.Run("Restore latest generation", func(t *testing.T) {
+		newStorage := NewMemStorage()
+		newStorage.KeepGenerations(2)
+
+		require.NoError(t, newStorage.RestoreFromDisk(path))
+		assert.Equal(t, float64(4), restoredValue(t, newStorage))
+	})
+
+	t.Run("Restore previous generation if latest is corrupt", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"metrics": {"test`), 0644))
+
+		newStorage := NewMemStorage()
+		newStorage.KeepGenerations(2)
+
+		require.NoError(t, newStorage.RestoreFromDisk(path))
+		assert.Equal(t, float64(3), restoredValue(t, newStorage))
+	})
+
+	t.Run("Restore previous generation if latest is missing", func(t *testing.T) {
+		require.NoError(t, os.Remove(path))
+		require.NoError(t, os.WriteFile(path+".1", []byte(`not json`), 0644))
+
+		newStorage := NewMemStorage()
+		newStorage.KeepGenerations(2)
+
+		require.NoError(t, newStorage.RestoreFromDisk(path))
+		assert.Equal(t, float64(2), restoredValue(t, newStorage))
+	})
+
+	t.Run("All generations are invalid", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path+".2", []byte(`not json`), 0644))
+
+		newStorage := NewMemStorage()
+		newStorage.KeepGenerations(2)
+
+		err := newStorage.RestoreFromDisk(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestMemStorage_RestoreFromDiskLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	t.Run("Metrics only", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"testg": {"id": "test", "type": "gauge", "value": 1}}`), 0644))
+
+		storage := NewMemStorage()
+		require.NoError(t, storage.RestoreFromDisk(path))
+
+		metric, err := storage.Get(context.Background(), "test", models.Gauge, nil)
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), *metric.Value)
+	})
+
+	t.Run("Invalid metric doesn't change storage", func(t *testing.T) {
+		// The first metric is decoded before the second one fails.
+		content := `{"testg": {"id": "test", "type": "gauge", "value": 1}, "otherg": {"id": 1}}`
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+		storage := NewMemStorage()
+		assert.Error(t, storage.RestoreFromDisk(path))
+
+		all, err := storage.GetAll(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, all)
+	})
+}
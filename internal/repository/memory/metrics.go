@@ -21,7 +21,7 @@ func NewMetrics() Metrics {
 	return Metrics{Collection: map[string]models.Metric{}, mu: sync.RWMutex{}}
 }
 
-func getKey(name string, valueType models.MetricType) string {
+func getKey(name string, valueType models.MetricType, labels models.Labels) string {
 	key := strings.Builder{}
 	key.WriteString(name)
 	switch valueType {
@@ -29,18 +29,27 @@ func getKey(name string, valueType models.MetricType) string {
 		key.WriteString("g")
 	case models.Counter:
 		key.WriteString("c")
+	case models.Histogram:
+		key.WriteString("h")
 	}
+	key.WriteString(labels.String())
 
 	return key.String()
 }
 
-// Get returns a models.Metric if metric is found.
+// Get returns a models.Metric without labels if metric is found.
 // If not apierror.NotFound error and nil models.Metric pointer returned.
 func (m *Metrics) Get(name string, valueType models.MetricType) (*models.Metric, error) {
+	return m.GetWithLabels(name, valueType, nil)
+}
+
+// GetWithLabels returns a models.Metric with given labels if metric is found.
+// If not apierror.NotFound error and nil models.Metric pointer returned.
+func (m *Metrics) GetWithLabels(name string, valueType models.MetricType, labels models.Labels) (*models.Metric, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	metric, ok := m.Collection[getKey(name, valueType)]
+	metric, ok := m.Collection[getKey(name, valueType, labels)]
 	if !ok {
 		return nil, apierror.NotFound
 	}
@@ -61,15 +70,30 @@ func (m *Metrics) GetAll() []models.Metric {
 	return all
 }
 
-// Update adds or replaces existing metric with new one.
+// Len returns number of series stored in Metrics.
+func (m *Metrics) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.Collection)
+}
+
+// Update adds or replaces existing metric without labels with new one.
 // Value is pattern matched with expected metric value type.
 // If the value does not match the expected type, apierror.InvalidValue is returned.
 func (m *Metrics) Update(name string, valueType models.MetricType, value interface{}) error {
-	if valueType != models.Gauge && valueType != models.Counter {
+	return m.UpdateWithLabels(name, valueType, nil, value)
+}
+
+// UpdateWithLabels adds or replaces existing metric with given labels with new one.
+// Value is pattern matched with expected metric value type.
+// If the value does not match the expected type, apierror.InvalidValue is returned.
+func (m *Metrics) UpdateWithLabels(name string, valueType models.MetricType, labels models.Labels, value interface{}) error {
+	if valueType != models.Gauge && valueType != models.Counter && valueType != models.Histogram {
 		return apierror.UnknownMetricType
 	}
 
-	metricKey := getKey(name, valueType)
+	metricKey := getKey(name, valueType, labels)
 
 	switch valueType {
 	case models.Gauge:
@@ -94,7 +118,7 @@ func (m *Metrics) Update(name string, valueType models.MetricType, value interfa
 		}
 
 		m.mu.Lock()
-		m.Collection[metricKey] = models.Metric{Name: name, MType: models.Gauge, Value: utils.Ptr(floatValue)}
+		m.Collection[metricKey] = models.Metric{Name: name, MType: models.Gauge, Value: utils.Ptr(floatValue), Labels: labels.Copy()}
 		m.mu.Unlock()
 	case models.Counter:
 		var intValue int64
@@ -114,7 +138,7 @@ func (m *Metrics) Update(name string, valueType models.MetricType, value interfa
 		}
 
 		m.mu.Lock()
-		prevMetric, ok := m.Collection[getKey(name, models.Counter)]
+		prevMetric, ok := m.Collection[metricKey]
 		var prevVal int64
 		if !ok {
 			prevVal = 0
@@ -122,8 +146,33 @@ func (m *Metrics) Update(name string, valueType models.MetricType, value interfa
 			prevVal = *prevMetric.Delta
 		}
 
-		m.Collection[metricKey] = models.Metric{Name: name, MType: models.Counter, Delta: utils.Ptr(prevVal + intValue)}
+		m.Collection[metricKey] = models.Metric{Name: name, MType: models.Counter, Delta: utils.Ptr(prevVal + intValue), Labels: labels.Copy()}
 		m.mu.Unlock()
+	case models.Histogram:
+		switch v := value.(type) {
+		case models.HistogramValue:
+			return m.mergeHistogram(name, labels, &v)
+		case *models.HistogramValue:
+			if v == nil {
+				return apierror.InvalidValue
+			}
+			return m.mergeHistogram(name, labels, v)
+		case float64:
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			var histogram *models.HistogramValue
+			if prevMetric, ok := m.Collection[metricKey]; ok {
+				histogram = prevMetric.Histogram.Copy()
+			} else {
+				histogram = models.NewHistogram(models.DefaultHistogramBuckets)
+			}
+			histogram.Observe(v)
+
+			m.Collection[metricKey] = models.Metric{Name: name, MType: models.Histogram, Histogram: histogram, Labels: labels.Copy()}
+		default:
+			return apierror.InvalidValue
+		}
 	default:
 		return apierror.UnknownMetricType
 	}
@@ -138,45 +187,147 @@ func (m *Metrics) UpdateWithStruct(metric *models.Metric) error {
 		return apierror.InvalidValue
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metricKey := getKey(metric.Name, metric.MType, metric.Labels)
+	prevMetric, ok := m.Collection[metricKey]
+
+	updated, err := applyMetric(prevMetric, ok, metric)
+	if err != nil {
+		return err
+	}
+
+	m.Collection[metricKey] = updated
+	return nil
+}
+
+// Updates applies metrics of the batch as a single transaction: updated values are staged first and
+// written under one lock, so readers see either none or all of them.
+// If any metric is invalid, its error is returned and nothing is written.
+func (m *Metrics) Updates(metrics []models.Metric) error {
+	return m.updates(metrics, false)
+}
+
+// UpdatesPartial applies valid metrics of the batch at once like Updates, invalid metrics are skipped
+// and reported in *apierror.BatchError without changing stored values.
+func (m *Metrics) UpdatesPartial(metrics []models.Metric) error {
+	return m.updates(metrics, true)
+}
+
+// updates stages metrics of the batch and writes them under one lock.
+// If partial is false, staged values are dropped on the first invalid metric.
+func (m *Metrics) updates(metrics []models.Metric, partial bool) error {
+	var batchError apierror.BatchError
+	staged := make(map[string]models.Metric, len(metrics))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range metrics {
+		metricKey := getKey(metrics[i].Name, metrics[i].MType, metrics[i].Labels)
+
+		prevMetric, ok := staged[metricKey]
+		if !ok {
+			prevMetric, ok = m.Collection[metricKey]
+		}
+
+		updated, err := applyMetric(prevMetric, ok, &metrics[i])
+		if err != nil && !partial {
+			return err
+		}
+		if err != nil {
+			batchError.Add(i, metrics[i].Name, err)
+			continue
+		}
+
+		staged[metricKey] = updated
+	}
+
+	for metricKey, metric := range staged {
+		m.Collection[metricKey] = metric
+	}
+
+	return batchError.Err()
+}
+
+// applyMetric returns metric which is stored after metric is applied to prevMetric, exists reports if prevMetric is stored.
+// Gauges replace stored value, counters are added to it and histograms are merged with it.
+func applyMetric(prevMetric models.Metric, exists bool, metric *models.Metric) (models.Metric, error) {
 	if len(metric.Name) == 0 {
-		return apierror.InvalidValue
+		return models.Metric{}, apierror.InvalidValue
+	}
+
+	if err := metric.Labels.Validate(); err != nil {
+		return models.Metric{}, err
 	}
 
 	switch metric.MType {
 	case models.Gauge:
 		if metric.Value == nil || metric.Delta != nil {
-			return apierror.InvalidValue
+			return models.Metric{}, apierror.InvalidValue
 		}
 
-		m.mu.Lock()
-		m.Collection[getKey(metric.Name, metric.MType)] = *metric
-		m.mu.Unlock()
+		stored := *metric
+		stored.Labels = metric.Labels.Copy()
+		return stored, nil
 	case models.Counter:
 		if metric.Delta == nil || metric.Value != nil {
-			return apierror.InvalidValue
+			return models.Metric{}, apierror.InvalidValue
 		}
 
-		m.mu.Lock()
-		prevMetric, ok := m.Collection[getKey(metric.Name, models.Counter)]
-		var prevVal, currentVal int64
-		if !ok {
-			prevVal = 0
-		} else {
+		var prevVal int64
+		if exists {
 			prevVal = *prevMetric.Delta
 		}
 
-		if metric.Delta == nil {
-			currentVal = 0
-		} else {
-			currentVal = *metric.Delta
+		return models.Metric{Name: metric.Name, MType: models.Counter, Delta: utils.Ptr(prevVal + *metric.Delta), Labels: metric.Labels.Copy(), Hash: metric.Hash}, nil
+	case models.Histogram:
+		if metric.Histogram == nil || metric.Value != nil || metric.Delta != nil {
+			return models.Metric{}, apierror.InvalidValue
 		}
 
-		m.Collection[getKey(metric.Name, metric.MType)] = models.Metric{Name: metric.Name, MType: models.Counter, Delta: utils.Ptr(prevVal + currentVal), Hash: metric.Hash}
-		m.mu.Unlock()
+		if err := metric.Histogram.Validate(); err != nil {
+			return models.Metric{}, err
+		}
+
+		merged := metric.Histogram.Copy()
+		if exists {
+			var err error
+			merged, err = prevMetric.Histogram.Merge(metric.Histogram)
+			if err != nil {
+				return models.Metric{}, err
+			}
+		}
+
+		return models.Metric{Name: metric.Name, MType: models.Histogram, Histogram: merged, Labels: metric.Labels.Copy()}, nil
 	default:
-		return apierror.UnknownMetricType
+		return models.Metric{}, apierror.UnknownMetricType
 	}
+}
+
+// mergeHistogram adds histogram to the stored one with the same name.
+// If the bucket bounds differ, apierror.BucketsMismatch is returned.
+func (m *Metrics) mergeHistogram(name string, labels models.Labels, histogram *models.HistogramValue) error {
+	if err := histogram.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	metricKey := getKey(name, models.Histogram, labels)
+
+	merged := histogram.Copy()
+	if prevMetric, ok := m.Collection[metricKey]; ok {
+		var err error
+		merged, err = prevMetric.Histogram.Merge(histogram)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.Collection[metricKey] = models.Metric{Name: name, MType: models.Histogram, Histogram: merged, Labels: labels.Copy()}
 	return nil
 }
 
@@ -185,5 +336,21 @@ func (m *Metrics) ResetPollCount() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.Collection[getKey("PollCount", models.Counter)] = models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(0))}
+	m.Collection[getKey("PollCount", models.Counter, nil)] = models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(0))}
+}
+
+// GetAllAndResetPollCount returns slice of all models.Metric and sets "PollCount" counter metric value to 0 atomically,
+// so every increment of "PollCount" is returned exactly once.
+func (m *Metrics) GetAllAndResetPollCount() []models.Metric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make([]models.Metric, 0, len(m.Collection))
+	for _, value := range m.Collection {
+		all = append(all, value)
+	}
+
+	m.Collection[getKey("PollCount", models.Counter, nil)] = models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(0))}
+
+	return all
 }
@@ -195,7 +195,7 @@ func TestMetrics_Update(t *testing.T) {
 
 			assert.EqualValues(t, tt.err, err)
 			if err == nil {
-				assert.True(t, true, reflect.DeepEqual(m.Collection[getKey(tt.args.name, tt.args.valueType)], tt.want))
+				assert.True(t, true, reflect.DeepEqual(m.Collection[getKey(tt.args.name, tt.args.valueType, nil)], tt.want))
 			}
 		})
 	}
@@ -205,6 +205,7 @@ func Test_getKey(t *testing.T) {
 	type args struct {
 		name      string
 		valueType models.MetricType
+		labels    models.Labels
 	}
 	tests := []struct {
 		name string
@@ -227,10 +228,19 @@ func Test_getKey(t *testing.T) {
 			},
 			want: "PollCountc",
 		},
+		{
+			name: "Find key with labels",
+			args: args{
+				name:      "Alloc",
+				valueType: models.Gauge,
+				labels:    models.Labels{"region": "eu", "host": "a"},
+			},
+			want: `Allocg{host="a",region="eu"}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, getKey(tt.args.name, tt.args.valueType))
+			assert.Equal(t, tt.want, getKey(tt.args.name, tt.args.valueType, tt.args.labels))
 		})
 	}
 }
@@ -295,6 +305,33 @@ func TestMetrics_UpdateWithStruct(t *testing.T) {
 			},
 			wantErr: apierror.InvalidValue,
 		},
+		{
+			name: "Update histogram",
+			metric: models.Metric{
+				Name:      "Latency",
+				MType:     models.Histogram,
+				Histogram: &models.HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 7},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "Histogram without buckets",
+			metric: models.Metric{
+				Name:      "Latency",
+				MType:     models.Histogram,
+				Histogram: &models.HistogramValue{Bounds: []float64{1, 2}},
+			},
+			wantErr: apierror.InvalidValue,
+		},
+		{
+			name: "Value for histogram",
+			metric: models.Metric{
+				Name:  "Latency",
+				MType: models.Histogram,
+				Value: utils.Ptr(float64(1)),
+			},
+			wantErr: apierror.InvalidValue,
+		},
 	}
 
 	for _, tt := range tests {
@@ -305,8 +342,165 @@ func TestMetrics_UpdateWithStruct(t *testing.T) {
 			assert.Equal(t, tt.wantErr, err)
 
 			if err == nil {
-				assert.True(t, true, reflect.DeepEqual(m.Collection[getKey(tt.metric.Name, tt.metric.MType)], tt.metric))
+				assert.True(t, true, reflect.DeepEqual(m.Collection[getKey(tt.metric.Name, tt.metric.MType, tt.metric.Labels)], tt.metric))
 			}
 		})
 	}
 }
+
+func TestMetrics_UpdateHistogram(t *testing.T) {
+	m := NewMetrics()
+
+	histogram := models.HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 7}
+	require.NoError(t, m.UpdateWithStruct(&models.Metric{Name: "Latency", MType: models.Histogram, Histogram: &histogram}))
+	require.NoError(t, m.UpdateWithStruct(&models.Metric{Name: "Latency", MType: models.Histogram, Histogram: &histogram}))
+
+	got, err := m.Get("Latency", models.Histogram)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 0, 4}, got.Histogram.Counts)
+	assert.Equal(t, float64(14), got.Histogram.Sum)
+	assert.Equal(t, []uint64{1, 0, 2}, histogram.Counts)
+
+	other := models.HistogramValue{Bounds: []float64{1, 3}, Counts: []uint64{1, 0, 2}}
+	assert.Equal(t, apierror.BucketsMismatch, m.UpdateWithStruct(&models.Metric{Name: "Latency", MType: models.Histogram, Histogram: &other}))
+
+	require.NoError(t, m.Update("Observed", models.Histogram, 0.3))
+	got, err = m.Get("Observed", models.Histogram)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultHistogramBuckets, got.Histogram.Bounds)
+	assert.Equal(t, uint64(1), got.Histogram.Count())
+}
+
+func TestMetrics_UpdateWithLabels(t *testing.T) {
+	m := NewMetrics()
+
+	require.NoError(t, m.UpdateWithStruct(&models.Metric{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(1.0), Labels: models.Labels{"host": "a"}}))
+	require.NoError(t, m.UpdateWithStruct(&models.Metric{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(2.0), Labels: models.Labels{"host": "b"}}))
+	require.NoError(t, m.UpdateWithStruct(&models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(1)), Labels: models.Labels{"host": "a"}}))
+	require.NoError(t, m.UpdateWithStruct(&models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(1)), Labels: models.Labels{"host": "b"}}))
+
+	got, err := m.GetWithLabels("Alloc", models.Gauge, models.Labels{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *got.Value)
+
+	got, err = m.GetWithLabels("PollCount", models.Counter, models.Labels{"host": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *got.Delta)
+
+	_, err = m.Get("Alloc", models.Gauge)
+	assert.Equal(t, apierror.NotFound, err)
+
+	assert.Equal(t, apierror.InvalidLabels, m.UpdateWithStruct(&models.Metric{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(2.0), Labels: models.Labels{"1host": "b"}}))
+}
+
+func TestMetrics_Updates(t *testing.T) {
+	m := NewMetrics()
+	require.NoError(t, m.Update("PollCount", models.Counter, 1))
+
+	histogram := models.HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5}
+
+	require.NoError(t, m.Updates([]models.Metric{
+		{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(2))},
+		{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(1.5)},
+		{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(3))},
+		{Name: "Latency", MType: models.Histogram, Histogram: &histogram},
+	}))
+
+	got, err := m.Get("PollCount", models.Counter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *got.Delta)
+
+	got, err = m.Get("Alloc", models.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	got, err = m.Get("Latency", models.Histogram)
+	require.NoError(t, err)
+	assert.Equal(t, histogram, *got.Histogram)
+}
+
+func TestMetrics_UpdatesInvalid(t *testing.T) {
+	m := NewMetrics()
+	require.NoError(t, m.Update("PollCount", models.Counter, 1))
+	require.NoError(t, m.Update("Latency", models.Histogram, 0.5))
+
+	before := m.GetAll()
+
+	// Valid metrics before and after the invalid one are not written either.
+	err := m.Updates([]models.Metric{
+		{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(2))},
+		{Name: "Alloc", MType: models.Gauge, Delta: utils.Ptr(int64(2))},
+		{Name: "Frees", MType: models.Gauge, Value: utils.Ptr(1.5)},
+	})
+	assert.Equal(t, apierror.InvalidValue, err)
+	assert.ElementsMatch(t, before, m.GetAll())
+
+	err = m.Updates([]models.Metric{
+		{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(1.5)},
+		{Name: "Latency", MType: models.Histogram, Histogram: &models.HistogramValue{Bounds: []float64{2}, Counts: []uint64{1, 0}}},
+	})
+	assert.Equal(t, apierror.BucketsMismatch, err)
+	assert.ElementsMatch(t, before, m.GetAll())
+}
+
+func TestMetrics_UpdatesPartial(t *testing.T) {
+	m := NewMetrics()
+	require.NoError(t, m.Update("PollCount", models.Counter, 1))
+
+	histogram := models.HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5}
+	other := models.HistogramValue{Bounds: []float64{2}, Counts: []uint64{1, 0}, Sum: 0.5}
+
+	err := m.UpdatesPartial([]models.Metric{
+		{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(2))},
+		{Name: "Alloc", MType: models.Gauge, Delta: utils.Ptr(int64(2))},
+		{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(3))},
+		{Name: "Latency", MType: models.Histogram, Histogram: &histogram},
+		{Name: "Latency", MType: models.Histogram, Histogram: &other},
+	})
+	assert.Equal(t, &apierror.BatchError{Items: []apierror.ItemError{
+		{Index: 1, Name: "Alloc", Err: apierror.InvalidValue},
+		{Index: 4, Name: "Latency", Err: apierror.BucketsMismatch},
+	}}, err)
+
+	got, err := m.Get("PollCount", models.Counter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *got.Delta)
+
+	got, err = m.Get("Latency", models.Histogram)
+	require.NoError(t, err)
+	assert.Equal(t, histogram, *got.Histogram)
+
+	_, err = m.Get("Alloc", models.Gauge)
+	assert.Equal(t, apierror.NotFound, err)
+}
+
+func TestMetrics_UpdatesAtomic(t *testing.T) {
+	m := NewMetrics()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, m.Updates([]models.Metric{
+				{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(float64(i))},
+				{Name: "Frees", MType: models.Gauge, Value: utils.Ptr(float64(i))},
+			}))
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		all := m.GetAll()
+		if len(all) == 0 {
+			continue
+		}
+
+		require.Len(t, all, 2)
+		assert.Equal(t, *all[0].Value, *all[1].Value, "batch is visible partially")
+	}
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -10,13 +11,31 @@ import (
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/instrument"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/tenant"
 )
 
 // DB is a Postgres database which implements Repository interface.
 type DB struct {
-	conn *sql.DB
+	conn        *sql.DB
+	instruments *instrument.Registry
+}
+
+// Instrument makes DB count failed queries in instrument.PostgresErrors of registry.
+func (p *DB) Instrument(registry *instrument.Registry) {
+	p.instruments = registry
+}
+
+// countError counts err by operation unless it isn't caused by database, e.g. metric is invalid or not found.
+func (p *DB) countError(operation string, err *error) {
+	if *err == nil || errors.Is(*err, sql.ErrNoRows) || errors.Is(*err, auth.ErrUnknownToken) || apierror.IsAPIError(*err) {
+		return
+	}
+
+	p.instruments.Inc(instrument.PostgresErrors, models.Labels{"operation": operation})
 }
 
 func (p *DB) SaveToDisk(filePath string) error {
@@ -35,7 +54,23 @@ func (p *DB) SupportsTx() bool {
 	return true
 }
 
-func (p *DB) Updates(ctx context.Context, metrics []models.Metric) error {
+func (p *DB) Updates(ctx context.Context, metrics []models.Metric) (err error) {
+	defer p.countError("updates", &err)
+
+	return p.updates(ctx, metrics, false)
+}
+
+func (p *DB) UpdatesPartial(ctx context.Context, metrics []models.Metric) (err error) {
+	defer p.countError("updates", &err)
+
+	return p.updates(ctx, metrics, true)
+}
+
+// updates writes batch in a single transaction. If partial is false, the transaction is rolled back
+// on the first invalid metric, otherwise invalid metrics are skipped and reported in *apierror.BatchError.
+func (p *DB) updates(ctx context.Context, metrics []models.Metric, partial bool) error {
+	tenantName := tenant.FromContext(ctx)
+
 	tx, err := p.conn.Begin()
 	if err != nil {
 		return err
@@ -43,60 +78,78 @@ func (p *DB) Updates(ctx context.Context, metrics []models.Metric) error {
 
 	defer tx.Rollback()
 
-	updateGaugeStmt, err := tx.PrepareContext(ctx, "INSERT INTO metrics (name, type, value) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET type = $2, value = $3")
+	updateGaugeStmt, err := tx.PrepareContext(ctx, updateGaugeQuery)
 	if err != nil {
 		return err
 	}
 	defer updateGaugeStmt.Close()
 
-	updateCounterStmt, err := tx.PrepareContext(ctx, "INSERT INTO metrics (name, type, delta) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET type = $2, delta = metrics.delta + $3")
+	updateCounterStmt, err := tx.PrepareContext(ctx, updateCounterQuery)
 	if err != nil {
 		return err
 	}
 	defer updateCounterStmt.Close()
 
-	for _, metric := range metrics {
-		switch metric.MType {
-		case models.Gauge:
-			if metric.Value == nil {
-				return apierror.InvalidValue
-			}
-			_, err := updateGaugeStmt.Exec(metric.Name, metric.MType, *metric.Value)
-			if err != nil {
+	var batchError apierror.BatchError
+	for i, metric := range metrics {
+		if err := validateMetric(metric); err != nil {
+			if !partial {
 				return err
 			}
+			batchError.Add(i, metric.Name, err)
+			continue
+		}
+
+		var err error
+		switch metric.MType {
+		case models.Gauge:
+			_, err = updateGaugeStmt.Exec(metric.Name, metric.MType, metric.Labels, *metric.Value, tenantName)
 		case models.Counter:
-			if metric.Delta == nil {
-				return apierror.InvalidValue
-			}
-			_, err := updateCounterStmt.Exec(metric.Name, metric.MType, *metric.Delta)
-			if err != nil {
-				return err
-			}
-		default:
-			return apierror.UnknownMetricType
+			_, err = updateCounterStmt.Exec(metric.Name, metric.MType, metric.Labels, *metric.Delta, tenantName)
+		case models.Histogram:
+			err = updateHistogram(ctx, tx, tenantName, metric)
+		}
+
+		// Histogram may not match stored one, other errors abort the transaction.
+		if apierror.IsAPIError(err) && partial {
+			batchError.Add(i, metric.Name, err)
+		} else if err != nil {
+			return err
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return batchError.Err()
 }
 
-func (p *DB) Ping(ctx context.Context) error {
+func (p *DB) Ping(ctx context.Context) (err error) {
+	defer p.countError("ping", &err)
+
 	return p.conn.PingContext(ctx)
 }
 
-func (p *DB) Update(ctx context.Context, metric models.Metric) error {
+func (p *DB) Update(ctx context.Context, metric models.Metric) (err error) {
+	defer p.countError("update", &err)
+
 	switch metric.MType {
 	case models.Gauge:
-		_, err := p.conn.ExecContext(ctx, "INSERT INTO metrics (name, type, value) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET type = $2, value = $3", metric.Name, metric.MType, *metric.Value)
+		_, err := p.conn.ExecContext(ctx, updateGaugeQuery, metric.Name, metric.MType, metric.Labels, *metric.Value, tenant.FromContext(ctx))
 		if err != nil {
 			return err
 		}
 	case models.Counter:
-		_, err := p.conn.ExecContext(ctx, "INSERT INTO metrics (name, type, delta) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET type = $2, delta = metrics.delta + $3", metric.Name, metric.MType, *metric.Delta)
+		_, err := p.conn.ExecContext(ctx, updateCounterQuery, metric.Name, metric.MType, metric.Labels, *metric.Delta, tenant.FromContext(ctx))
 		if err != nil {
 			return err
 		}
+	case models.Histogram:
+		if metric.Histogram == nil {
+			return apierror.InvalidValue
+		}
+		return p.updateHistogramWithTx(ctx, metric)
 	default:
 		return apierror.UnknownMetricType
 	}
@@ -104,25 +157,36 @@ func (p *DB) Update(ctx context.Context, metric models.Metric) error {
 	return nil
 }
 
-func (p *DB) UpdateWithStruct(ctx context.Context, metric *models.Metric) error {
+func (p *DB) UpdateWithStruct(ctx context.Context, metric *models.Metric) (err error) {
+	defer p.countError("update", &err)
+
 	if metric == nil || len(metric.Name) == 0 {
 		return apierror.InvalidValue
 	}
 
-	var err error
+	if err := metric.Labels.Validate(); err != nil {
+		return err
+	}
+
 	switch metric.MType {
 	case models.Gauge:
 		if metric.Value == nil || metric.Delta != nil {
 			return apierror.InvalidValue
 		}
 
-		_, err = p.conn.ExecContext(ctx, "INSERT INTO metrics (name, type, value) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET type = $2, value = $3", metric.Name, metric.MType, *metric.Value)
+		_, err = p.conn.ExecContext(ctx, updateGaugeQuery, metric.Name, metric.MType, metric.Labels, *metric.Value, tenant.FromContext(ctx))
 	case models.Counter:
 		if metric.Delta == nil || metric.Value != nil {
 			return apierror.InvalidValue
 		}
 
-		_, err = p.conn.ExecContext(ctx, "INSERT INTO metrics (name, type, delta) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET type = $2, delta = metrics.delta + $3", metric.Name, metric.MType, *metric.Delta)
+		_, err = p.conn.ExecContext(ctx, updateCounterQuery, metric.Name, metric.MType, metric.Labels, *metric.Delta, tenant.FromContext(ctx))
+	case models.Histogram:
+		if metric.Histogram == nil || metric.Value != nil || metric.Delta != nil {
+			return apierror.InvalidValue
+		}
+
+		err = p.updateHistogramWithTx(ctx, *metric)
 	default:
 		return apierror.UnknownMetricType
 	}
@@ -134,19 +198,29 @@ func (p *DB) UpdateWithStruct(ctx context.Context, metric *models.Metric) error
 	return nil
 }
 
-func (p *DB) Get(ctx context.Context, key string, valueType models.MetricType) (*models.Metric, error) {
+func (p *DB) Get(ctx context.Context, key string, valueType models.MetricType, labels models.Labels) (_ *models.Metric, err error) {
+	defer p.countError("get", &err)
+
+	tenantName := tenant.FromContext(ctx)
+
 	var metric models.Metric
 	var result *sql.Row
-	var err error
 	switch valueType {
 	case models.Gauge:
-		result = p.conn.QueryRowContext(ctx, "SELECT name, type, value FROM metrics WHERE name = $1 AND type = $2", key, valueType)
+		result = p.conn.QueryRowContext(ctx, "SELECT name, type, labels, value FROM metrics WHERE name = $1 AND type = $2 AND labels = $3 AND tenant = $4", key, valueType, labels, tenantName)
 		metric.Value = new(float64)
-		err = result.Scan(&metric.Name, &metric.MType, &metric.Value)
+		err = result.Scan(&metric.Name, &metric.MType, &metric.Labels, &metric.Value)
 	case models.Counter:
-		result = p.conn.QueryRowContext(ctx, "SELECT name, type, delta FROM metrics WHERE name = $1 AND type = $2", key, valueType)
+		result = p.conn.QueryRowContext(ctx, "SELECT name, type, labels, delta FROM metrics WHERE name = $1 AND type = $2 AND labels = $3 AND tenant = $4", key, valueType, labels, tenantName)
 		metric.Delta = new(int64)
-		err = result.Scan(&metric.Name, &metric.MType, &metric.Delta)
+		err = result.Scan(&metric.Name, &metric.MType, &metric.Labels, &metric.Delta)
+	case models.Histogram:
+		result = p.conn.QueryRowContext(ctx, "SELECT name, type, labels, histogram FROM metrics WHERE name = $1 AND type = $2 AND labels = $3 AND tenant = $4", key, valueType, labels, tenantName)
+		var histogram []byte
+		err = result.Scan(&metric.Name, &metric.MType, &metric.Labels, &histogram)
+		if err == nil {
+			err = json.Unmarshal(histogram, &metric.Histogram)
+		}
 	default:
 		return nil, apierror.NotFound
 	}
@@ -161,8 +235,10 @@ func (p *DB) Get(ctx context.Context, key string, valueType models.MetricType) (
 	return &metric, nil
 }
 
-func (p *DB) GetAll(ctx context.Context) ([]models.Metric, error) {
-	rows, err := p.conn.QueryContext(ctx, "SELECT name, type, value, delta FROM metrics")
+func (p *DB) GetAll(ctx context.Context) (_ []models.Metric, err error) {
+	defer p.countError("get_all", &err)
+
+	rows, err := p.conn.QueryContext(ctx, "SELECT name, type, labels, value, delta, histogram FROM metrics WHERE tenant = $1", tenant.FromContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -174,8 +250,9 @@ func (p *DB) GetAll(ctx context.Context) ([]models.Metric, error) {
 		var metric models.Metric
 		var value sql.NullFloat64
 		var delta sql.NullInt64
+		var histogram []byte
 
-		err := rows.Scan(&metric.Name, &metric.MType, &value, &delta)
+		err := rows.Scan(&metric.Name, &metric.MType, &metric.Labels, &value, &delta, &histogram)
 		if err != nil {
 			return nil, err
 		}
@@ -193,6 +270,14 @@ func (p *DB) GetAll(ctx context.Context) ([]models.Metric, error) {
 			}
 
 			metric.Delta = &delta.Int64
+		case models.Histogram:
+			if histogram == nil {
+				return nil, errors.New("invalid histogram value, got NULL")
+			}
+
+			if err := json.Unmarshal(histogram, &metric.Histogram); err != nil {
+				return nil, fmt.Errorf("invalid histogram value, got error: %s", err)
+			}
 		default:
 			return nil, apierror.UnknownMetricType
 		}
@@ -208,6 +293,200 @@ func (p *DB) GetAll(ctx context.Context) ([]models.Metric, error) {
 	return result, nil
 }
 
+func (p *DB) CountSeries(ctx context.Context) (_ int, err error) {
+	defer p.countError("count_series", &err)
+
+	var count int
+	err = p.conn.QueryRowContext(ctx, "SELECT count(*) FROM metrics WHERE tenant = $1", tenant.FromContext(ctx)).Scan(&count)
+	return count, err
+}
+
+func (p *DB) CountAllSeries(ctx context.Context) (_ int, err error) {
+	defer p.countError("count_series", &err)
+
+	var count int
+	err = p.conn.QueryRowContext(ctx, "SELECT count(*) FROM metrics").Scan(&count)
+	return count, err
+}
+
+func (p *DB) GetRange(ctx context.Context, key string, valueType models.MetricType, labels models.Labels, from time.Time, to time.Time) (_ []models.Sample, err error) {
+	defer p.countError("get_range", &err)
+
+	rows, err := p.conn.QueryContext(ctx, "SELECT ts, value, delta, histogram FROM samples WHERE name = $1 AND type = $2 AND labels = $3 AND ts >= $4 AND ts <= $5 AND tenant = $6 ORDER BY ts", key, valueType, labels, from, to, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make([]models.Sample, 0)
+	for rows.Next() {
+		var sample models.Sample
+		var value sql.NullFloat64
+		var delta sql.NullInt64
+		var histogram []byte
+
+		if err := rows.Scan(&sample.Timestamp, &value, &delta, &histogram); err != nil {
+			return nil, err
+		}
+
+		if value.Valid {
+			sample.Value = &value.Float64
+		}
+		if delta.Valid {
+			sample.Delta = &delta.Int64
+		}
+		if histogram != nil {
+			if err := json.Unmarshal(histogram, &sample.Histogram); err != nil {
+				return nil, fmt.Errorf("invalid histogram value, got error: %s", err)
+			}
+		}
+
+		result = append(result, sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *DB) Compact(ctx context.Context, retention models.Retention, now time.Time) (err error) {
+	defer p.countError("compact", &err)
+
+	if len(retention) == 0 {
+		return nil
+	}
+
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var newer time.Duration
+	for _, window := range retention {
+		if window.Resolution != 0 {
+			_, err := tx.ExecContext(ctx, downsampleSamplesQuery, now.Add(-window.Period), now.Add(-newer), window.Resolution.Seconds())
+			if err != nil {
+				return err
+			}
+		}
+
+		newer = window.Period
+	}
+
+	if _, err := tx.ExecContext(ctx, deleteExpiredSamplesQuery, now.Add(-newer)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// validateMetric checks that metric of the batch has labels and value of its type.
+func validateMetric(metric models.Metric) error {
+	if err := metric.Labels.Validate(); err != nil {
+		return err
+	}
+
+	switch metric.MType {
+	case models.Gauge:
+		if metric.Value == nil {
+			return apierror.InvalidValue
+		}
+	case models.Counter:
+		if metric.Delta == nil {
+			return apierror.InvalidValue
+		}
+	case models.Histogram:
+		if metric.Histogram == nil {
+			return apierror.InvalidValue
+		}
+	default:
+		return apierror.UnknownMetricType
+	}
+
+	return nil
+}
+
+// updateHistogramWithTx merges histogram metric with the stored one in a separate transaction.
+func (p *DB) updateHistogramWithTx(ctx context.Context, metric models.Metric) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := updateHistogram(ctx, tx, tenant.FromContext(ctx), metric); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateHistogram locks stored histogram row of the tenant, merges it with given metric and writes the result back.
+// Histograms can't be merged in SQL as buckets are stored in json.
+func updateHistogram(ctx context.Context, tx *sql.Tx, tenantName string, metric models.Metric) error {
+	if err := metric.Histogram.Validate(); err != nil {
+		return err
+	}
+
+	var stored []byte
+	err := tx.QueryRowContext(ctx, "SELECT histogram FROM metrics WHERE name = $1 AND type = $2 AND labels = $3 AND tenant = $4 FOR UPDATE", metric.Name, metric.MType, metric.Labels, tenantName).Scan(&stored)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	merged := metric.Histogram
+	if stored != nil {
+		var prev models.HistogramValue
+		if err := json.Unmarshal(stored, &prev); err != nil {
+			return fmt.Errorf("invalid stored histogram value, got error: %s", err)
+		}
+
+		merged, err = prev.Merge(metric.Histogram)
+		if err != nil {
+			return err
+		}
+	}
+
+	histogramJSON, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, updateHistogramQuery, metric.Name, metric.MType, metric.Labels, string(histogramJSON), tenantName)
+	return err
+}
+
+// LookupToken implements auth.TokenStore, tokens are read from agent_tokens table on every call,
+// so revoked tokens are rejected immediately.
+func (p *DB) LookupToken(ctx context.Context, token string) (_ auth.Agent, err error) {
+	defer p.countError("lookup_token", &err)
+
+	var agent auth.Agent
+	var role string
+	var agentTenant sql.NullString
+	err = p.conn.QueryRowContext(ctx, lookupTokenQuery, auth.HashToken(token)).Scan(&agent.Name, &role, &agentTenant)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.Agent{}, auth.ErrUnknownToken
+		}
+		return auth.Agent{}, err
+	}
+
+	agent.Role, err = auth.ParseRole(role)
+	if err != nil {
+		return auth.Agent{}, err
+	}
+	agent.Tenant = agentTenant.String
+
+	return agent, nil
+}
+
 func New(url string) (*DB, error) {
 	if len(url) == 0 {
 		log.Printf("No database url provided, skipping database initialization")
@@ -226,9 +505,9 @@ func New(url string) (*DB, error) {
 		return nil, fmt.Errorf("couldn't create default sqlite tables with error %s", err.Error())
 	}
 
-	return &DB{conn}, nil
+	return &DB{conn: conn}, nil
 }
 
 func NewFromDB(db *sql.DB) (*DB, error) {
-	return &DB{db}, nil
+	return &DB{conn: db}, nil
 }
@@ -9,9 +9,11 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/require"
 
+	"go-metricscol/internal/auth"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository"
 	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/tenant"
 )
 
 // TODO: Кажется не совсем правильно, что я пишу запрос ручками. А вдруг он изменится? Поискать другой способ.
@@ -25,16 +27,16 @@ func TestDB_Get(t *testing.T) {
 	defer db.Close()
 	mock.MatchExpectationsInOrder(false)
 
-	mock.ExpectQuery(`SELECT name, type, value FROM metrics`).
-		WithArgs("Alloc", models.Gauge).
-		WillReturnRows(sqlmock.NewRows([]string{"name", "type", "value"}).AddRow("Alloc", models.Gauge, 101.42))
+	mock.ExpectQuery(`SELECT name, type, labels, value FROM metrics`).
+		WithArgs("Alloc", models.Gauge, models.Labels{}, tenant.Default).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "type", "labels", "value"}).AddRow("Alloc", models.Gauge, "{}", 101.42))
 
-	mock.ExpectQuery(`SELECT name, type, delta FROM metrics`).
-		WithArgs("PollCount", models.Counter).
-		WillReturnRows(sqlmock.NewRows([]string{"name", "type", "delta"}).AddRow("PollCount", models.Counter, 1))
+	mock.ExpectQuery(`SELECT name, type, labels, delta FROM metrics`).
+		WithArgs("PollCount", models.Counter, models.Labels{}, tenant.Default).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "type", "labels", "delta"}).AddRow("PollCount", models.Counter, "{}", 1))
 
-	mock.ExpectQuery(`SELECT name, type, delta FROM metrics`).
-		WithArgs("Alloc", models.Counter).
+	mock.ExpectQuery(`SELECT name, type, labels, delta FROM metrics`).
+		WithArgs("Alloc", models.Counter, models.Labels{}, tenant.Default).
 		WillReturnError(apierror.NotFound)
 
 	postgres, err := NewFromDB(db)
@@ -57,11 +59,12 @@ func TestDB_GetAll(t *testing.T) {
 	defer db.Close()
 	mock.MatchExpectationsInOrder(false)
 
-	mock.ExpectQuery(`SELECT name, type, value, delta FROM metrics`).
+	mock.ExpectQuery(`SELECT name, type, labels, value, delta, histogram FROM metrics`).
+		WithArgs(tenant.Default).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"name", "type", "value", "delta"}).
-				AddRow("Alloc", models.Gauge, 101.42, sql.NullInt64{}).
-				AddRow("PollCount", models.Counter, sql.NullFloat64{}, 1),
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 101.42, sql.NullInt64{}, nil).
+				AddRow("PollCount", models.Counter, "{}", sql.NullFloat64{}, 1, nil),
 		)
 
 	postgres, err := NewFromDB(db)
@@ -84,11 +87,11 @@ func TestDB_Update(t *testing.T) {
 
 	// TODO: Подумать как сделать проверку на то, что в запросе есть все нужные поля
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("Alloc", models.Gauge, 120.123).
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("PollCount", models.Counter, 2).
+		WithArgs("PollCount", models.Counter, models.Labels{}, 2, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	postgres, err := NewFromDB(db)
@@ -109,25 +112,25 @@ func TestDB_UpdateWithStruct(t *testing.T) {
 	mock.MatchExpectationsInOrder(false)
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("Alloc", models.Gauge, 120.123).
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	mock.ExpectQuery("SELECT name, type, value FROM metrics").
-		WithArgs("Alloc", models.Gauge).
+	mock.ExpectQuery("SELECT name, type, labels, value FROM metrics").
+		WithArgs("Alloc", models.Gauge, models.Labels{}, tenant.Default).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"name", "type", "value"}).
-				AddRow("Alloc", models.Gauge, 120.123),
+			sqlmock.NewRows([]string{"name", "type", "labels", "value"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123),
 		)
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("PollCount", models.Counter, 2).
+		WithArgs("PollCount", models.Counter, models.Labels{}, 2, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	mock.ExpectQuery("SELECT name, type, delta FROM metrics").
-		WithArgs("PollCount", models.Counter).
+	mock.ExpectQuery("SELECT name, type, labels, delta FROM metrics").
+		WithArgs("PollCount", models.Counter, models.Labels{}, tenant.Default).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"name", "type", "delta"}).
-				AddRow("PollCount", models.Counter, 2),
+			sqlmock.NewRows([]string{"name", "type", "labels", "delta"}).
+				AddRow("PollCount", models.Counter, "{}", 2),
 		)
 
 	postgres, err := NewFromDB(db)
@@ -153,19 +156,20 @@ func TestDB_Updates(t *testing.T) {
 	mock.ExpectPrepare("INSERT INTO metrics")
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("Alloc", models.Gauge, 120.123).
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("PollCount", models.Counter, 1).
+		WithArgs("PollCount", models.Counter, models.Labels{}, 1, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	mock.ExpectQuery("SELECT name, type, value, delta FROM metrics").
+	mock.ExpectQuery("SELECT name, type, labels, value, delta, histogram FROM metrics").
+		WithArgs(tenant.Default).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"name", "type", "value", "delta"}).
-				AddRow("Alloc", models.Gauge, 120.123, sql.NullInt64{}).
-				AddRow("PollCount", models.Counter, sql.NullFloat64{}, 1),
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123, sql.NullInt64{}, nil).
+				AddRow("PollCount", models.Counter, "{}", sql.NullFloat64{}, 1, nil),
 		)
 	// #2
 
@@ -174,14 +178,18 @@ func TestDB_Updates(t *testing.T) {
 	mock.ExpectPrepare("INSERT INTO metrics")
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("Alloc", models.Gauge, 120.123).
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
+	// Invalid metric rolls back the whole batch, metrics of #1 are still stored.
 	mock.ExpectRollback()
 
-	mock.ExpectQuery("SELECT name, type, value, delta FROM metrics").
+	mock.ExpectQuery("SELECT name, type, labels, value, delta, histogram FROM metrics").
+		WithArgs(tenant.Default).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"name", "type", "value", "delta"}),
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123, sql.NullInt64{}, nil).
+				AddRow("PollCount", models.Counter, "{}", sql.NullFloat64{}, 1, nil),
 		)
 	//	#3
 
@@ -190,14 +198,18 @@ func TestDB_Updates(t *testing.T) {
 	mock.ExpectPrepare("INSERT INTO metrics")
 
 	mock.ExpectExec("INSERT INTO metrics").
-		WithArgs("Alloc", models.Gauge, 120.123).
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
+	// Invalid metric rolls back the whole batch, metrics of #1 are still stored.
 	mock.ExpectRollback()
 
-	mock.ExpectQuery("SELECT name, type, value, delta FROM metrics").
+	mock.ExpectQuery("SELECT name, type, labels, value, delta, histogram FROM metrics").
+		WithArgs(tenant.Default).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"name", "type", "value", "delta"}),
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123, sql.NullInt64{}, nil).
+				AddRow("PollCount", models.Counter, "{}", sql.NullFloat64{}, 1, nil),
 		)
 
 	postgres, err := NewFromDB(db)
@@ -210,3 +222,182 @@ func TestDB_Updates(t *testing.T) {
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestDB_UpdatesPartial(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	// #1
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO metrics")
+	mock.ExpectPrepare("INSERT INTO metrics")
+
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("PollCount", models.Counter, models.Labels{}, 1, tenant.Default).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("SELECT name, type, labels, value, delta, histogram FROM metrics").
+		WithArgs(tenant.Default).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123, sql.NullInt64{}, nil).
+				AddRow("PollCount", models.Counter, "{}", sql.NullFloat64{}, 1, nil),
+		)
+	// #2
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO metrics")
+	mock.ExpectPrepare("INSERT INTO metrics")
+
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("SELECT name, type, labels, value, delta, histogram FROM metrics").
+		WithArgs(tenant.Default).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123, sql.NullInt64{}, nil),
+		)
+	//	#3
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO metrics")
+	mock.ExpectPrepare("INSERT INTO metrics")
+
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("Alloc", models.Gauge, models.Labels{}, 120.123, tenant.Default).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("SELECT name, type, labels, value, delta, histogram FROM metrics").
+		WithArgs(tenant.Default).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"name", "type", "labels", "value", "delta", "histogram"}).
+				AddRow("Alloc", models.Gauge, "{}", 120.123, sql.NullInt64{}, nil),
+		)
+
+	postgres, err := NewFromDB(db)
+	require.NoError(t, err)
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFunc()
+
+	repository.TestUpdatesPartial(ctx, t, postgres)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_GetRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	mock.ExpectQuery(`SELECT ts, value, delta, histogram FROM samples`).
+		WithArgs("PollCount", models.Counter, models.Labels{}, from, to, tenant.Default).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"ts", "value", "delta", "histogram"}).
+				AddRow(from.Add(time.Minute), nil, 1, nil).
+				AddRow(from.Add(2*time.Minute), nil, 3, nil),
+		)
+
+	postgres, err := NewFromDB(db)
+	require.NoError(t, err)
+
+	samples, err := postgres.GetRange(context.Background(), "PollCount", models.Counter, nil, from, to)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	require.Equal(t, from.Add(time.Minute), samples[0].Timestamp)
+	require.Equal(t, int64(3), *samples[1].Delta)
+	require.Nil(t, samples[1].Value)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_Compact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	retention := models.Retention{
+		{Period: time.Hour},
+		{Resolution: time.Minute, Period: 24 * time.Hour},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM samples WHERE ctid IN`).
+		WithArgs(now.Add(-24*time.Hour), now.Add(-time.Hour), float64(60)).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(`DELETE FROM samples WHERE ts <=`).
+		WithArgs(now.Add(-24 * time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+
+	postgres, err := NewFromDB(db)
+	require.NoError(t, err)
+
+	require.NoError(t, postgres.Compact(context.Background(), retention, now))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_CountSeries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM metrics WHERE tenant = \$1`).
+		WithArgs("team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	postgres, err := NewFromDB(db)
+	require.NoError(t, err)
+
+	count, err := postgres.CountSeries(tenant.NewContext(context.Background(), "team-a"))
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_LookupToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT agent, role, tenant FROM agent_tokens WHERE token_hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(auth.HashToken("token-1")).
+		WillReturnRows(sqlmock.NewRows([]string{"agent", "role", "tenant"}).AddRow("agent-1", "reader", "team-a"))
+	mock.ExpectQuery(`SELECT agent, role, tenant FROM agent_tokens`).
+		WithArgs(auth.HashToken("revoked")).
+		WillReturnError(sql.ErrNoRows)
+
+	postgres, err := NewFromDB(db)
+	require.NoError(t, err)
+
+	agent, err := postgres.LookupToken(context.Background(), "token-1")
+	require.NoError(t, err)
+	require.Equal(t, auth.Agent{Name: "agent-1", Role: auth.Reader, Tenant: "team-a"}, agent)
+
+	_, err = postgres.LookupToken(context.Background(), "revoked")
+	require.ErrorIs(t, err, auth.ErrUnknownToken)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
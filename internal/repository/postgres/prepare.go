@@ -1,10 +1,67 @@
 package postgres
 
 const CreateTable = `CREATE TABLE IF NOT EXISTS metrics(
-	name VARCHAR PRIMARY KEY,
+	tenant VARCHAR NOT NULL DEFAULT 'default',
+	name VARCHAR NOT NULL,
 	type VARCHAR NOT NULL,
+	labels jsonb NOT NULL DEFAULT '{}',
 	value double precision,
-	delta bigint
+	delta bigint,
+	histogram jsonb
 );
 
-CREATE INDEX IF NOT EXISTS metrics_type ON metrics(type);`
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram jsonb;
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant VARCHAR NOT NULL DEFAULT 'default';
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+
+DROP INDEX IF EXISTS metrics_series;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_tenant_series ON metrics(tenant, name, type, labels);
+CREATE INDEX IF NOT EXISTS metrics_type ON metrics(type);
+
+CREATE TABLE IF NOT EXISTS samples(
+	tenant VARCHAR NOT NULL DEFAULT 'default',
+	name VARCHAR NOT NULL,
+	type VARCHAR NOT NULL,
+	labels jsonb NOT NULL DEFAULT '{}',
+	ts timestamptz NOT NULL,
+	value double precision,
+	delta bigint,
+	histogram jsonb
+);
+
+ALTER TABLE samples ADD COLUMN IF NOT EXISTS tenant VARCHAR NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS samples_series_ts;
+CREATE INDEX IF NOT EXISTS samples_tenant_series_ts ON samples(tenant, name, type, labels, ts);
+
+CREATE TABLE IF NOT EXISTS agent_tokens(
+	token_hash VARCHAR PRIMARY KEY,
+	agent VARCHAR NOT NULL,
+	role VARCHAR NOT NULL DEFAULT 'writer',
+	tenant VARCHAR,
+	revoked_at timestamptz
+);
+
+ALTER TABLE agent_tokens ADD COLUMN IF NOT EXISTS role VARCHAR NOT NULL DEFAULT 'writer';
+ALTER TABLE agent_tokens ADD COLUMN IF NOT EXISTS tenant VARCHAR;`
+
+// Series is identified by tenant, name, type and labels, see metrics_tenant_series index.
+// Every update appends the resulting value of the series to samples table.
+const (
+	updateGaugeQuery     = "WITH updated AS (INSERT INTO metrics (name, type, labels, value, tenant) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (tenant, name, type, labels) DO UPDATE SET value = $4 RETURNING tenant, name, type, labels, value, delta, histogram) " + appendSampleQuery
+	updateCounterQuery   = "WITH updated AS (INSERT INTO metrics (name, type, labels, delta, tenant) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (tenant, name, type, labels) DO UPDATE SET delta = metrics.delta + $4 RETURNING tenant, name, type, labels, value, delta, histogram) " + appendSampleQuery
+	updateHistogramQuery = "WITH updated AS (INSERT INTO metrics (name, type, labels, histogram, tenant) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (tenant, name, type, labels) DO UPDATE SET histogram = $4 RETURNING tenant, name, type, labels, value, delta, histogram) " + appendSampleQuery
+
+	appendSampleQuery = "INSERT INTO samples (tenant, name, type, labels, ts, value, delta, histogram) SELECT tenant, name, type, labels, now(), value, delta, histogram FROM updated"
+)
+
+// Samples in (from, to] are grouped into intervals of the given length in seconds, only the last sample of the interval is kept.
+const (
+	downsampleSamplesQuery    = "DELETE FROM samples WHERE ctid IN (SELECT ctid FROM (SELECT ctid, row_number() OVER (PARTITION BY tenant, name, type, labels, floor(extract(epoch FROM ts) / $3) ORDER BY ts DESC) AS rn FROM samples WHERE ts > $1 AND ts <= $2) ranked WHERE rn > 1)"
+	deleteExpiredSamplesQuery = "DELETE FROM samples WHERE ts <= $1"
+)
+
+// Tokens are stored as SHA-256 hashes, see auth.HashToken. Token is revoked by setting revoked_at.
+// Agent with NULL tenant chooses tenant itself.
+const lookupTokenQuery = "SELECT agent, role, tenant FROM agent_tokens WHERE token_hash = $1 AND revoked_at IS NULL"
@@ -2,28 +2,49 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"go-metricscol/internal/models"
 )
 
 // Repository is interface that describes the storage of models.Metric.
+// Metrics of every tenant are stored separately, methods with context work with metrics of the tenant
+// stored in it, see tenant.FromContext.
 type Repository interface {
 	// Update adds or replaces existing metric with new one.
 	Update(ctx context.Context, metric models.Metric) error
 
 	// Updates adds or replaces multiple metrics in storage.
+	// If any metric is invalid, its error is returned and nothing is stored if repository supports transactions.
 	Updates(ctx context.Context, metrics []models.Metric) error
 
+	// UpdatesPartial adds or replaces valid metrics of the batch, invalid metrics are skipped
+	// and reported in *apierror.BatchError.
+	UpdatesPartial(ctx context.Context, metrics []models.Metric) error
+
 	// UpdateWithStruct adds or replaces metric that was passed as models.Metric struct.
 	UpdateWithStruct(ctx context.Context, metric *models.Metric) error
 
-	// Get returns models.Metric if found.
+	// Get returns models.Metric with exactly the given labels if found.
 	// If not apierror.NotFound error and nil models.Metric pointer returned.
-	Get(ctx context.Context, key string, valueType models.MetricType) (*models.Metric, error)
+	Get(ctx context.Context, key string, valueType models.MetricType, labels models.Labels) (*models.Metric, error)
 
 	// GetAll returns slice of all models.Metric stored in repository.
 	GetAll(ctx context.Context) ([]models.Metric, error)
 
+	// CountSeries returns number of series stored by the tenant.
+	CountSeries(ctx context.Context) (int, error)
+
+	// CountAllSeries returns number of series stored by all tenants.
+	CountAllSeries(ctx context.Context) (int, error)
+
+	// GetRange returns samples of the series written between from and to inclusive, ordered by time.
+	// If there are no samples in the range, empty slice is returned.
+	GetRange(ctx context.Context, key string, valueType models.MetricType, labels models.Labels, from time.Time, to time.Time) ([]models.Sample, error)
+
+	// Compact downsamples and deletes samples of all tenants according to retention at the moment now.
+	Compact(ctx context.Context, retention models.Retention, now time.Time) error
+
 	// SupportsTx returns if repository supports transactions.
 	SupportsTx() bool
 
@@ -106,7 +106,7 @@ func TestGet(ctx context.Context, t *testing.T, storage Repository) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := storage.Get(ctx, tt.args.key, tt.args.valueType)
+			got, err := storage.Get(ctx, tt.args.key, tt.args.valueType, nil)
 			assert.Equal(t, tt.want, got)
 			assert.Equal(t, tt.err, err)
 		})
@@ -178,7 +178,7 @@ func TestUpdateWithStruct(ctx context.Context, t *testing.T, storage Repository)
 			err := tt.storage.UpdateWithStruct(ctx, &tt.args)
 			assert.Equal(t, tt.err, err)
 			if err == nil {
-				m, err := storage.Get(ctx, tt.args.Name, tt.args.MType)
+				m, err := storage.Get(ctx, tt.args.Name, tt.args.MType, tt.args.Labels)
 				require.NoError(t, err)
 				assert.Equal(t, tt.args, *m)
 			}
@@ -245,6 +245,8 @@ func TestUpdates(ctx context.Context, t *testing.T, storage Repository) {
 			err: apierror.InvalidValue,
 		},
 	}
+	// stored are metrics stored by the last successful batch.
+	var stored []models.Metric
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.storage.Updates(ctx, tt.args)
@@ -255,11 +257,90 @@ func TestUpdates(ctx context.Context, t *testing.T, storage Repository) {
 
 			if tt.err == nil {
 				assert.EqualValues(t, tt.args, all)
+				stored = all
 			} else {
+				// Invalid batch doesn't change storage.
 				if ok := storage.SupportsTx(); ok {
-					assert.Empty(t, all)
+					assert.ElementsMatch(t, stored, all)
 				}
 			}
 		})
 	}
 }
+
+func TestUpdatesPartial(ctx context.Context, t *testing.T, storage Repository) {
+	tests := []struct {
+		name    string
+		storage Repository
+		args    []models.Metric
+		err     error
+	}{
+		{
+			name:    "Updates",
+			storage: storage,
+			args: []models.Metric{
+				{
+					Name:  "Alloc",
+					Value: utils.Ptr(120.123),
+					MType: models.Gauge,
+				},
+				{
+					Name:  "PollCount",
+					Delta: utils.Ptr(int64(1)),
+					MType: models.Counter,
+				},
+			},
+			err: nil,
+		},
+		{
+			name:    "Gauge with delta",
+			storage: storage,
+			args: []models.Metric{
+				{
+					Name:  "Alloc",
+					Value: utils.Ptr(120.123),
+					MType: models.Gauge,
+				},
+				{
+					Name:  "PollCount",
+					Delta: utils.Ptr(int64(1)),
+					MType: models.Gauge,
+				},
+			},
+			err: &apierror.BatchError{Items: []apierror.ItemError{{Index: 1, Name: "PollCount", Err: apierror.InvalidValue}}},
+		},
+		{
+			name:    "Counter with non-empty value field",
+			storage: storage,
+			args: []models.Metric{
+				{
+					Name:  "Alloc",
+					Value: utils.Ptr(120.123),
+					MType: models.Gauge,
+				},
+				{
+					Name:  "PollCount",
+					Value: utils.Ptr(1.34),
+					MType: models.Counter,
+				},
+			},
+			err: &apierror.BatchError{Items: []apierror.ItemError{{Index: 1, Name: "PollCount", Err: apierror.InvalidValue}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.storage.UpdatesPartial(ctx, tt.args)
+			assert.Equal(t, tt.err, err)
+
+			all, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+
+			if tt.err == nil {
+				assert.EqualValues(t, tt.args, all)
+			} else {
+				// Valid metrics of the batch are stored.
+				assert.Contains(t, all, tt.args[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package apierror
+
+import "fmt"
+
+// ItemError is an error of the metric at Index of the batch.
+type ItemError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+// BatchError is returned by batch updates which applied valid metrics of the batch and skipped invalid ones.
+// Items lists skipped metrics in order of their indexes.
+type BatchError struct {
+	Items []ItemError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Items) == 0 {
+		return "all metrics of the batch are updated"
+	}
+
+	first := e.Items[0]
+	return fmt.Sprintf("couldn't update %d metrics of the batch, metric %s at index %d: %s", len(e.Items), first.Name, first.Index, first.Err)
+}
+
+// Add reports that the metric at index of the batch is skipped with err.
+func (e *BatchError) Add(index int, name string, err error) {
+	e.Items = append(e.Items, ItemError{Index: index, Name: name, Err: err})
+}
+
+// Err returns e if any metric of the batch is skipped, otherwise nil.
+func (e *BatchError) Err() error {
+	if len(e.Items) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// ItemProblem is a body of the error of the metric at Index of the batch.
+type ItemProblem struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// NewItemProblems converts errors of skipped metrics of the batch to their response bodies.
+func NewItemProblems(batchError *BatchError) []ItemProblem {
+	result := make([]ItemProblem, 0, len(batchError.Items))
+	for _, item := range batchError.Items {
+		problem := NewProblem(item.Err)
+		result = append(result, ItemProblem{
+			Index:  item.Index,
+			Name:   item.Name,
+			Status: problem.Status,
+			Code:   problem.Code,
+			Detail: problem.Detail,
+		})
+	}
+
+	return result
+}
@@ -1,60 +1,316 @@
 package apierror
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 )
 
+// ProblemContentType is a media type of error responses described in RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// APIError is an error returned to clients. Code is a stable machine-readable name of the error,
+// clients should rely on it instead of Message.
 type APIError struct {
 	StatusCode int
+	Code       string
 	Message    string
 }
 
-func NewAPIError(statusCode int, message string) *APIError {
-	return &APIError{StatusCode: statusCode, Message: message}
+func NewAPIError(statusCode int, code string, message string) *APIError {
+	return &APIError{StatusCode: statusCode, Code: code, Message: message}
 }
 
 func (apiError APIError) Error() string {
 	return apiError.Message
 }
 
-func WriteHTTP(w http.ResponseWriter, err error) {
+// IsAPIError returns true if err is caused by the request, i.e. it's or wraps APIError.
+func IsAPIError(err error) bool {
 	var apiError APIError
-	if errors.As(err, &apiError) {
-		w.WriteHeader(apiError.StatusCode)
-	} else {
-		w.WriteHeader(http.StatusInternalServerError)
+	var apiErrorPtr *APIError
+	return errors.As(err, &apiError) || errors.As(err, &apiErrorPtr)
+}
+
+// detailedError is an APIError caused by the particular request field or metric.
+type detailedError struct {
+	err    error
+	field  string
+	metric string
+}
+
+func (e detailedError) Error() string {
+	switch {
+	case len(e.metric) != 0:
+		return fmt.Sprintf("metric %s: %s", e.metric, e.err)
+	case len(e.field) != 0:
+		return fmt.Sprintf("field %s: %s", e.field, e.err)
+	default:
+		return e.err.Error()
+	}
+}
+
+func (e detailedError) Unwrap() error {
+	return e.err
+}
+
+// WithField returns err which reports the field of request body that caused it.
+func WithField(err error, field string) error {
+	if err == nil {
+		return nil
+	}
+
+	detailed := detailedError{err: err}
+	errors.As(err, &detailed)
+	detailed.field = field
+	return detailed
+}
+
+// WithMetric returns err which reports the name of metric that caused it.
+func WithMetric(err error, metric string) error {
+	if err == nil {
+		return nil
+	}
+
+	detailed := detailedError{err: err}
+	errors.As(err, &detailed)
+	detailed.metric = metric
+	return detailed
+}
+
+// JSONError converts error of json.Unmarshal to InvalidJSON which reports the field of invalid type.
+func JSONError(err error) error {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && len(typeError.Field) != 0 {
+		return WithField(InvalidJSON, typeError.Field)
+	}
+
+	return InvalidJSON
+}
+
+// Problem is a body of error response in RFC 7807 format extended with code, field and metric members.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	Field  string `json:"field,omitempty"`
+	Metric string `json:"metric,omitempty"`
+
+	// Errors lists skipped metrics of partially applied batch, see BatchError.
+	Errors []ItemProblem `json:"errors,omitempty"`
+}
+
+// NewProblem converts err to Problem. Errors other than APIError are reported as internal errors without details,
+// so messages of storage errors don't leak to clients.
+func NewProblem(err error) Problem {
+	apiError := Internal
+	var apiErrorPtr *APIError
+	var batchError *BatchError
+	switch {
+	case errors.As(err, &batchError):
+		apiError = PartialUpdate
+	case errors.As(err, &apiError):
+	case errors.As(err, &apiErrorPtr):
+		apiError = *apiErrorPtr
+	}
+
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(apiError.StatusCode),
+		Status: apiError.StatusCode,
+		Detail: apiError.Message,
+		Code:   apiError.Code,
+	}
+
+	var detailed detailedError
+	if errors.As(err, &detailed) {
+		problem.Field = detailed.field
+		problem.Metric = detailed.metric
+	}
+
+	if batchError != nil {
+		problem.Errors = NewItemProblems(batchError)
+	}
+
+	return problem
+}
+
+// WriteHTTP writes err as problem+json response with status code of the error.
+func WriteHTTP(w http.ResponseWriter, err error) {
+	problem := NewProblem(err)
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Couldn't write error response with error: %s", err)
 	}
 }
 
 var (
+	Internal = APIError{
+		StatusCode: http.StatusInternalServerError,
+		Code:       "internal",
+		Message:    "internal server error",
+	}
+
+	InvalidJSON = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid_json",
+		Message:    "couldn't parse json",
+	}
+
+	DatabaseUnavailable = APIError{
+		StatusCode: http.StatusInternalServerError,
+		Code:       "database_unavailable",
+		Message:    "couldn't ping db",
+	}
+
+	PartialUpdate = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "partial_update",
+		Message:    "some metrics of the batch are invalid, valid metrics are updated",
+	}
+
+	MethodNotAllowed = APIError{
+		StatusCode: http.StatusMethodNotAllowed,
+		Code:       "method_not_allowed",
+		Message:    "method not allowed",
+	}
+
 	UnknownMetricType = APIError{
 		StatusCode: http.StatusNotImplemented,
+		Code:       "unknown_metric_type",
 		Message:    "unknown metric type",
 	}
 
 	EmptyArguments = APIError{
 		StatusCode: http.StatusNotFound,
+		Code:       "empty_arguments",
 		Message:    "empty arguments",
 	}
 
 	InvalidValue = APIError{
 		StatusCode: http.StatusBadRequest,
+		Code:       "invalid_value",
 		Message:    "invalid value",
 	}
 
 	NumberParse = APIError{
 		StatusCode: http.StatusBadRequest,
+		Code:       "number_parse",
 		Message:    "couldn't parse number",
 	}
 
 	NotFound = APIError{
 		StatusCode: http.StatusNotFound,
+		Code:       "not_found",
 		Message:    "not found",
 	}
 
+	BucketsMismatch = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "buckets_mismatch",
+		Message:    "histogram bucket bounds mismatch",
+	}
+
+	InvalidLabels = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid_labels",
+		Message:    "invalid labels",
+	}
+
+	InvalidRange = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid_range",
+		Message:    "invalid time range",
+	}
+
+	InvalidLineProtocol = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid_line_protocol",
+		Message:    "invalid line protocol",
+	}
+
+	DecryptionFailed = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "decryption_failed",
+		Message:    "couldn't decrypt request",
+	}
+
+	BodyHashMismatch = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "body_hash_mismatch",
+		Message:    "body hash mismatch",
+	}
+
+	MissingNonce = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "missing_nonce",
+		Message:    "signed metric has no nonce",
+	}
+
+	OutsideReplayWindow = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "outside_replay_window",
+		Message:    "signed metric timestamp is outside replay window",
+	}
+
+	ReplayedRequest = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "replayed_request",
+		Message:    "signed metric is replayed",
+	}
+
 	Unauthorized = APIError{
 		StatusCode: http.StatusUnauthorized,
+		Code:       "unauthorized",
 		Message:    "unauthorized",
 	}
+
+	Forbidden = APIError{
+		StatusCode: http.StatusForbidden,
+		Code:       "forbidden",
+		Message:    "permission denied",
+	}
+
+	InvalidTenant = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "invalid_tenant",
+		Message:    "invalid tenant",
+	}
+
+	TenantRateLimited = APIError{
+		StatusCode: http.StatusTooManyRequests,
+		Code:       "tenant_rate_limited",
+		Message:    "tenant request rate limit exceeded",
+	}
+
+	TenantSeriesQuotaExceeded = APIError{
+		StatusCode: http.StatusInsufficientStorage,
+		Code:       "tenant_series_quota_exceeded",
+		Message:    "tenant series quota exceeded",
+	}
+
+	ReservedMetricName = APIError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "reserved_metric_name",
+		Message:    "metric name prefix is reserved for server metrics",
+	}
+
+	SeriesLimitExceeded = APIError{
+		StatusCode: http.StatusInsufficientStorage,
+		Code:       "series_limit_exceeded",
+		Message:    "series limit exceeded",
+	}
+
+	NewSeriesRateLimited = APIError{
+		StatusCode: http.StatusTooManyRequests,
+		Code:       "new_series_rate_limited",
+		Message:    "new series rate limit exceeded",
+	}
 )
@@ -0,0 +1,126 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		problem Problem
+	}{
+		{
+			name: "API error",
+			err:  UnknownMetricType,
+			problem: Problem{
+				Type:   "about:blank",
+				Title:  "Not Implemented",
+				Status: http.StatusNotImplemented,
+				Detail: "unknown metric type",
+				Code:   "unknown_metric_type",
+			},
+		},
+		{
+			name: "API error pointer",
+			err:  NewAPIError(http.StatusForbidden, "not_in_trusted_subnet", "X-Real-IP is not in trusted subnet"),
+			problem: Problem{
+				Type:   "about:blank",
+				Title:  "Forbidden",
+				Status: http.StatusForbidden,
+				Detail: "X-Real-IP is not in trusted subnet",
+				Code:   "not_in_trusted_subnet",
+			},
+		},
+		{
+			name: "Wrapped error with metric",
+			err:  fmt.Errorf("couldn't update: %w", WithMetric(ReservedMetricName, "metricscol_up")),
+			problem: Problem{
+				Type:   "about:blank",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				Detail: "metric name prefix is reserved for server metrics",
+				Code:   "reserved_metric_name",
+				Metric: "metricscol_up",
+			},
+		},
+		{
+			name: "Internal error",
+			err:  errors.New("connection refused"),
+			problem: Problem{
+				Type:   "about:blank",
+				Title:  "Internal Server Error",
+				Status: http.StatusInternalServerError,
+				Detail: "internal server error",
+				Code:   "internal",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			WriteHTTP(rr, tt.err)
+
+			assert.Equal(t, tt.problem.Status, rr.Code)
+			assert.Equal(t, ProblemContentType, rr.Header().Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+			assert.Equal(t, tt.problem, problem)
+		})
+	}
+}
+
+func TestWithField(t *testing.T) {
+	err := WithField(WithMetric(InvalidValue, "Alloc"), "value")
+
+	assert.ErrorIs(t, err, InvalidValue)
+	assert.Equal(t, "metric Alloc: invalid value", err.Error())
+
+	problem := NewProblem(err)
+	assert.Equal(t, "value", problem.Field)
+	assert.Equal(t, "Alloc", problem.Metric)
+
+	assert.NoError(t, WithField(nil, "value"))
+}
+
+func TestJSONError(t *testing.T) {
+	var metric struct {
+		Delta *int64 `json:"delta"`
+	}
+
+	err := JSONError(json.Unmarshal([]byte(`{"delta": "1"}`), &metric))
+	assert.ErrorIs(t, err, InvalidJSON)
+	assert.Equal(t, "delta", NewProblem(err).Field)
+
+	err = JSONError(json.Unmarshal([]byte(`{`), &metric))
+	assert.Equal(t, InvalidJSON, err)
+}
+
+func TestWriteHTTP_BatchError(t *testing.T) {
+	var batchError BatchError
+	assert.NoError(t, batchError.Err())
+
+	batchError.Add(1, "PollCount", InvalidValue)
+	batchError.Add(3, "Alloc", errors.New("connection refused"))
+
+	rr := httptest.NewRecorder()
+	WriteHTTP(rr, fmt.Errorf("couldn't write: %w", batchError.Err()))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, PartialUpdate.Code, problem.Code)
+	assert.Equal(t, []ItemProblem{
+		{Index: 1, Name: "PollCount", Status: http.StatusBadRequest, Code: "invalid_value", Detail: "invalid value"},
+		{Index: 3, Name: "Alloc", Status: http.StatusInternalServerError, Code: "internal", Detail: "internal server error"},
+	}, problem.Errors)
+}
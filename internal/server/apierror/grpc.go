@@ -0,0 +1,78 @@
+package apierror
+
+import (
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is a domain of errdetails.ErrorInfo attached to gRPC errors.
+const ErrorDomain = "metricscol"
+
+// GRPCCode returns gRPC status code which has the same meaning as HTTP status code.
+func GRPCCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	if statusCode >= http.StatusBadRequest && statusCode < http.StatusInternalServerError {
+		return codes.FailedPrecondition
+	}
+
+	return codes.Internal
+}
+
+// GRPCStatus converts err to gRPC status error, so gRPC clients get the same semantics as HTTP clients.
+// Code of the error is attached as errdetails.ErrorInfo reason together with field and metric in its metadata,
+// the field is also reported as errdetails.BadRequest violation. Errors which already have gRPC status are returned as is.
+func GRPCStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	problem := NewProblem(err)
+	st := status.New(GRPCCode(problem.Status), problem.Detail)
+
+	info := &errdetails.ErrorInfo{Reason: problem.Code, Domain: ErrorDomain}
+	if len(problem.Field) != 0 || len(problem.Metric) != 0 {
+		info.Metadata = make(map[string]string)
+	}
+	if len(problem.Field) != 0 {
+		info.Metadata["field"] = problem.Field
+	}
+	if len(problem.Metric) != 0 {
+		info.Metadata["metric"] = problem.Metric
+	}
+
+	withDetails, detailsErr := st.WithDetails(info)
+	if len(problem.Field) != 0 {
+		withDetails, detailsErr = st.WithDetails(info, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: problem.Field, Description: problem.Detail}},
+		})
+	}
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,71 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCCode(t *testing.T) {
+	tests := []struct {
+		err  APIError
+		code codes.Code
+	}{
+		{err: NotFound, code: codes.NotFound},
+		{err: InvalidValue, code: codes.InvalidArgument},
+		{err: UnknownMetricType, code: codes.Unimplemented},
+		{err: Forbidden, code: codes.PermissionDenied},
+		{err: Unauthorized, code: codes.Unauthenticated},
+		{err: TenantRateLimited, code: codes.ResourceExhausted},
+		{err: SeriesLimitExceeded, code: codes.ResourceExhausted},
+		{err: DatabaseUnavailable, code: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Code, func(t *testing.T) {
+			assert.Equal(t, tt.code, GRPCCode(tt.err.StatusCode))
+		})
+	}
+
+	assert.Equal(t, codes.FailedPrecondition, GRPCCode(http.StatusConflict))
+}
+
+func TestGRPCStatus(t *testing.T) {
+	st := status.Convert(GRPCStatus(WithField(WithMetric(NumberParse, "Alloc"), "value")))
+
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, NumberParse.Message, st.Message())
+
+	details := st.Details()
+	require.Len(t, details, 2)
+
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, "number_parse", info.Reason)
+	assert.Equal(t, ErrorDomain, info.Domain)
+	assert.Equal(t, map[string]string{"field": "value", "metric": "Alloc"}, info.Metadata)
+
+	badRequest, ok := details[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 1)
+	assert.Equal(t, "value", badRequest.FieldViolations[0].Field)
+}
+
+func TestGRPCStatus_Internal(t *testing.T) {
+	st := status.Convert(GRPCStatus(errors.New("connection refused")))
+
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.Equal(t, Internal.Message, st.Message())
+}
+
+func TestGRPCStatus_Status(t *testing.T) {
+	err := status.Error(codes.Unavailable, "unavailable")
+
+	assert.Equal(t, err, GRPCStatus(err))
+	assert.NoError(t, GRPCStatus(nil))
+}
@@ -7,6 +7,7 @@ type BackendType int
 const (
 	GRPCType BackendType = iota
 	HTTPType
+	StatsDType
 )
 
 type Backend interface {
@@ -5,7 +5,9 @@ import (
 	"net"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"go-metricscol/internal/auth"
 	"go-metricscol/internal/config"
 	"go-metricscol/internal/proto"
 	"go-metricscol/internal/repository"
@@ -16,6 +18,16 @@ import (
 	"go-metricscol/internal/server/middleware"
 )
 
+// grpcRoles are roles required to call rpc methods, methods missing here require auth.Admin.
+var grpcRoles = map[string]auth.Role{
+	proto.Metrics_UpdateMetric_FullMethodName:  auth.Writer,
+	proto.Metrics_UpdatesMetric_FullMethodName: auth.Writer,
+	proto.Metrics_ValueMetric_FullMethodName:   auth.Reader,
+	proto.Metrics_ListMetrics_FullMethodName:   auth.Reader,
+	proto.Metrics_RangeMetric_FullMethodName:   auth.Reader,
+	proto.Health_Ping_FullMethodName:           auth.Reader,
+}
+
 type Grpc struct {
 	server   *grpc.Server
 	listener net.Listener
@@ -27,14 +39,32 @@ func NewGrpc(repo repository.Repository, config *config.ServerConfig, listener n
 
 	mw := middleware.NewManager(metricsUC, healthUC, config, repo)
 
-	server := grpc.NewServer(
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var options []grpc.ServerOption
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	options = append(options,
 		grpc.ChainUnaryInterceptor(
+			mw.GrpcInstrumentHandler,
 			mw.DiskSaverGrpcMiddleware,
+			mw.GrpcClientIdentityHandler,
+			mw.GrpcAuthHandler,
+			mw.GrpcRoleHandler(grpcRoles),
+			mw.GrpcTenantHandler,
+			mw.DecryptGrpcHandler,
 			mw.ValidateHashGrpcHandler,
 			mw.GrpcTrustedSubnetHandler,
 			mw.ValidateHashesGrpcHandler,
 		))
 
+	server := grpc.NewServer(options...)
+
 	proto.RegisterHealthServer(server, healthGrpc.NewHealthHandlers(healthUC))
 	proto.RegisterMetricsServer(server, metricsGrpc.NewMetricsHandlers(metricsUC, config))
 
@@ -0,0 +1,221 @@
+package backends
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/agent"
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/proto"
+	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/tenant"
+	"go-metricscol/internal/utils"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// writeCertificate creates certificate signed by parent, or self-signed CA if parent is nil, and writes it to dir.
+func writeCertificate(t *testing.T, dir, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer := &testCertificate{certificate: template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.certificate, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func TestGrpc_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeCertificate(t, dir, "ca", nil)
+	writeCertificate(t, dir, "server", ca)
+	writeCertificate(t, dir, "agent", ca)
+
+	cfg := &config.ServerConfig{
+		TLSCertFile:     filepath.Join(dir, "server.crt"),
+		TLSKeyFile:      filepath.Join(dir, "server.key"),
+		TLSClientCAFile: filepath.Join(dir, "ca.crt"),
+		TrustedSubnet:   "127.0.0.0/8",
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server, err := NewGrpc(memory.NewMemStorage(), cfg, listener)
+	require.NoError(t, err)
+	go server.ListenAndServe()
+	defer server.GracefulShutdown(context.Background())
+
+	tests := []struct {
+		name        string
+		agentConfig agent.Config
+		wantErr     bool
+	}{
+		{
+			name: "Client certificate",
+			agentConfig: agent.Config{
+				TLSCAFile:   filepath.Join(dir, "ca.crt"),
+				TLSCertFile: filepath.Join(dir, "agent.crt"),
+				TLSKeyFile:  filepath.Join(dir, "agent.key"),
+			},
+		},
+		{
+			name:        "No client certificate",
+			agentConfig: agent.Config{TLSCAFile: filepath.Join(dir, "ca.crt")},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := tt.agentConfig.TLSConfig()
+			require.NoError(t, err)
+
+			conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+			require.NoError(t, err)
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err = proto.NewMetricsClient(conn).ListMetrics(ctx, &proto.ListRequest{})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGrpc_ListMetricsOfTenant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("token-a agent-a reader team-a\ntoken-b agent-b reader team-b\n"), 0600))
+
+	tokens, err := auth.NewFileTokenStore(path)
+	require.NoError(t, err)
+
+	storage := memory.NewMemStorage()
+	for _, name := range []string{"team-a", "team-b"} {
+		metric := models.Metric{Name: name + "-metric", MType: models.Gauge, Value: utils.Ptr(float64(1))}
+		require.NoError(t, storage.UpdateWithStruct(tenant.NewContext(context.Background(), name), &metric))
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server, err := NewGrpc(storage, &config.ServerConfig{Tokens: tokens}, listener)
+	require.NoError(t, err)
+	go server.ListenAndServe()
+	defer server.GracefulShutdown(context.Background())
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token-a")
+
+	response, err := proto.NewMetricsClient(conn).ListMetrics(ctx, &proto.ListRequest{})
+	require.NoError(t, err)
+
+	require.Len(t, response.Metric, 1)
+	assert.Equal(t, "team-a-metric", response.Metric[0].Name)
+}
+
+func TestGrpc_UpdatesMetric(t *testing.T) {
+	storage := memory.NewMemStorage()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server, err := NewGrpc(storage, &config.ServerConfig{}, listener)
+	require.NoError(t, err)
+	go server.ListenAndServe()
+	defer server.GracefulShutdown(context.Background())
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metrics := []*proto.Metric{
+		{Name: "Alloc", Type: proto.MetricType_GAUGE, Value: "1"},
+		{Name: "PollCount", Type: proto.MetricType_COUNTER, Value: "1.5"},
+	}
+
+	t.Run("Invalid batch is rejected", func(t *testing.T) {
+		_, err := proto.NewMetricsClient(conn).UpdatesMetric(ctx, &proto.UpdatesRequest{Metric: metrics})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		all, err := storage.GetAll(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, all)
+	})
+
+	t.Run("Partial batch", func(t *testing.T) {
+		response, err := proto.NewMetricsClient(conn).UpdatesMetric(ctx, &proto.UpdatesRequest{Metric: metrics, Partial: true})
+		require.NoError(t, err)
+
+		require.Len(t, response.Errors, 1)
+		assert.Equal(t, int32(1), response.Errors[0].Index)
+
+		all, err := storage.GetAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, all, 1)
+		assert.Equal(t, "Alloc", all[0].Name)
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"go-metricscol/internal/config"
 	"go-metricscol/internal/repository"
+	"go-metricscol/internal/server/apierror"
 	healthHttp "go-metricscol/internal/server/health/delivery/http"
 	healthUseCase "go-metricscol/internal/server/health/usecase"
 	metricsUseCase "go-metricscol/internal/server/metrics/usecase"
@@ -30,27 +31,52 @@ func NewHTTP(repo repository.Repository, config *config.ServerConfig) (*HTTP, er
 
 	mw := middleware.NewManager(metricsUC, healthUC, config, repo)
 
-	r.Use(chiMiddleware.Compress(5, "text/html", "text/css", "application/javascript", "application/json", "text/plain", "text/xml"))
+	r.Use(mw.HTTPInstrumentHandler)
+	r.Use(chiMiddleware.Compress(5, "text/html", "text/css", "application/javascript", "application/json", apierror.ProblemContentType, "text/plain", "text/xml"))
 	r.Use(chiMiddleware.Logger)
 	r.Use(mw.DecompressHandler)
 	r.Use(chiMiddleware.AllowContentEncoding("gzip"))
+	r.Use(mw.HTTPClientIdentityHandler)
+	r.Use(mw.HTTPAuthHandler)
+	r.Use(mw.HTTPTenantHandler)
 	r.Use(mw.HTTPTrustedSubnetHandler)
 
 	healthHttp.NewHealthHandlers(healthUC)
 
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierror.WriteHTTP(w, apierror.NotFound)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		apierror.WriteHTTP(w, apierror.MethodNotAllowed)
+	})
+
 	metricsHttp.MapMetricsRoutes(r, metricsHttp.NewMetricsHandlers(metricsUC, config), mw)
 	healthHttp.MapHealthRoutes(r, healthHttp.NewHealthHandlers(healthUC))
 
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	httpServer := http.Server{
-		Addr:    config.Address,
-		Handler: r,
+		Addr:      config.Address,
+		Handler:   r,
+		TLSConfig: tlsConfig,
 	}
 
 	return &HTTP{server: &httpServer}, nil
 }
 
+// ListenAndServe serves HTTPS if TLS certificate is set in config, otherwise HTTP.
 func (s HTTP) ListenAndServe() error {
-	if err := s.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+	var err error
+	if s.server.TLSConfig != nil {
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	return nil
@@ -0,0 +1,79 @@
+package backends
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/agent"
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/repository/memory"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestHTTP_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeCertificate(t, dir, "ca", nil)
+	writeCertificate(t, dir, "server", ca)
+	writeCertificate(t, dir, "agent", ca)
+
+	cfg := &config.ServerConfig{
+		Address:         freeAddress(t),
+		TLSCertFile:     filepath.Join(dir, "server.crt"),
+		TLSKeyFile:      filepath.Join(dir, "server.key"),
+		TLSClientCAFile: filepath.Join(dir, "ca.crt"),
+		TrustedSubnet:   "127.0.0.0/8",
+	}
+
+	server, err := NewHTTP(memory.NewMemStorage(), cfg)
+	require.NoError(t, err)
+	go server.ListenAndServe()
+	defer server.GracefulShutdown(context.Background())
+
+	agentConfig := agent.Config{
+		TLSCAFile:   filepath.Join(dir, "ca.crt"),
+		TLSCertFile: filepath.Join(dir, "agent.crt"),
+		TLSKeyFile:  filepath.Join(dir, "agent.key"),
+	}
+	tlsConfig, err := agentConfig.TLSConfig()
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 5 * time.Second}
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", cfg.Address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Certificate address 127.0.0.1 is checked instead of self-reported X-Real-IP.
+	request, err := http.NewRequest(http.MethodGet, "https://"+cfg.Address+"/", nil)
+	require.NoError(t, err)
+	request.Header.Set("X-Real-IP", "10.0.0.5")
+
+	resp, err := client.Do(request)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Cleartext requests are rejected.
+	resp, err = http.Get("http://" + cfg.Address + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,104 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/repository"
+	healthUseCase "go-metricscol/internal/server/health/usecase"
+	metricsStatsd "go-metricscol/internal/server/metrics/delivery/statsd"
+	metricsUseCase "go-metricscol/internal/server/metrics/usecase"
+	"go-metricscol/internal/server/middleware"
+)
+
+// maxStatsDPacketSize is the maximum size of UDP datagram.
+const maxStatsDPacketSize = 65535
+
+// StatsD receives StatsD packets over UDP and flushes aggregated metrics every StatsDFlushInterval.
+type StatsD struct {
+	conn          net.PacketConn
+	handlers      *metricsStatsd.MetricsHandlers
+	flush         func(ctx context.Context) error
+	flushInterval time.Duration
+
+	done    chan struct{}
+	flushWg sync.WaitGroup
+}
+
+func NewStatsD(repo repository.Repository, config *config.ServerConfig, conn net.PacketConn) (*StatsD, error) {
+	metricsUC := metricsUseCase.NewMetricsUC(repo, config)
+	healthUC := healthUseCase.NewHealthUC(repo)
+
+	mw := middleware.NewManager(metricsUC, healthUC, config, repo)
+	handlers := metricsStatsd.NewMetricsHandlers(metricsUC, config)
+
+	return &StatsD{
+		conn:          conn,
+		handlers:      handlers,
+		flush:         mw.DiskSaverStatsDMiddleware(handlers.Flush),
+		flushInterval: config.StatsDFlushInterval,
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (s *StatsD) ListenAndServe() error {
+	s.flushWg.Add(1)
+	go s.flushLoop()
+
+	buf := make([]byte, maxStatsDPacketSize)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.handlers.Handle(buf[:n])
+	}
+}
+
+func (s *StatsD) flushLoop() {
+	defer s.flushWg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.flushInterval)
+			if err := s.flush(ctx); err != nil {
+				log.Printf("Couldn't flush statsd metrics with error: %s", err)
+			}
+			cancel()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// GracefulShutdown stops receiving packets and flushes metrics aggregated so far.
+func (s *StatsD) GracefulShutdown(ctx context.Context) error {
+	close(s.done)
+	err := s.conn.Close()
+	s.flushWg.Wait()
+
+	if flushErr := s.flush(ctx); flushErr != nil {
+		return flushErr
+	}
+
+	return err
+}
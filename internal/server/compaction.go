@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// enableCompaction periodically downsamples and deletes expired samples until ctx is done.
+func (s Server) enableCompaction(ctx context.Context) {
+	ticker := time.NewTicker(s.Config.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			compactCtx, cancel := context.WithTimeout(ctx, s.Config.CompactInterval)
+			if err := s.Repo.Compact(compactCtx, s.Config.Retention, time.Now()); err != nil {
+				log.Printf("Couldn't compact metrics history with error: %s", err)
+			}
+			cancel()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
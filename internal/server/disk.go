@@ -17,15 +17,22 @@ func (s Server) enableSavingToDisk(ctx context.Context) error {
 	for {
 		select {
 		case <-ticker.C:
-			if err := s.Repo.SaveToDisk(s.Config.StoreFile); err != nil {
+			if err := s.saveToDisk(); err != nil {
 				log.Printf("Couldn't save metrics to disk with error: %s", err)
 			}
 
 		case <-ctx.Done():
-			if err := s.Repo.SaveToDisk(s.Config.StoreFile); err != nil {
+			if err := s.saveToDisk(); err != nil {
 				log.Printf("Couldn't save metrics to disk with error: %s", err)
 			}
 			return nil
 		}
 	}
 }
+
+// saveToDisk saves metrics to store file and records duration of saving with "interval" mode.
+func (s Server) saveToDisk() error {
+	return s.Config.Instruments().TimeDiskSave("interval", func() error {
+		return s.Repo.SaveToDisk(s.Config.StoreFile)
+	})
+}
@@ -2,12 +2,11 @@ package grpc
 
 import (
 	"context"
+	"log"
 	"time"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-
 	"go-metricscol/internal/proto"
+	"go-metricscol/internal/server/apierror"
 	"go-metricscol/internal/server/health"
 )
 
@@ -26,7 +25,8 @@ func (g HealthHandlers) Ping(ctx context.Context, _ *proto.PingRequest) (*proto.
 
 	err := g.healthUC.Ping(ctx)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "couldn't ping db: %s", err)
+		log.Printf("Couldn't ping db with error: %s", err)
+		return nil, apierror.GRPCStatus(apierror.DatabaseUnavailable)
 	}
 
 	return &proto.PingResponse{}, nil
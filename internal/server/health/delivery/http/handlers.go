@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"go-metricscol/internal/server/apierror"
 	"go-metricscol/internal/server/health"
 )
 
@@ -23,7 +24,7 @@ func (h HealthHandlers) Ping(w http.ResponseWriter, r *http.Request) {
 
 	err := h.healthUC.Ping(ctx)
 	if err != nil {
-		http.Error(w, "couldn't ping db", http.StatusInternalServerError)
+		apierror.WriteHTTP(w, apierror.DatabaseUnavailable)
 		log.Printf("Couldn't ping db with error: %s", err)
 	} else {
 		w.WriteHeader(http.StatusOK)
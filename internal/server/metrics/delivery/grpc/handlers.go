@@ -2,13 +2,14 @@ package grpc
 
 import (
 	"context"
-
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"errors"
+	"sort"
+	"time"
 
 	"go-metricscol/internal/config"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/proto"
+	"go-metricscol/internal/server/apierror"
 	"go-metricscol/internal/server/metrics"
 )
 
@@ -23,75 +24,161 @@ func (g MetricsHandlers) UpdateMetric(ctx context.Context, request *proto.Update
 
 	requestMetric, err := proto.ParseMetricFromRequest(request.Metric)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "couldn't parse metric from request: %s", err)
+		return nil, apierror.GRPCStatus(apierror.WithMetric(err, request.Metric.GetName()))
 	}
 
 	if err := g.metricsUC.Update(ctx, *requestMetric); err != nil {
-		return nil, status.Errorf(codes.Internal, "couldn't update metric: %s", err)
+		return nil, apierror.GRPCStatus(err)
 	}
 
 	return &response, nil
 }
 
+// UpdatesMetric stores metrics of the request at once or not at all. If partial is set in the request,
+// valid metrics are stored and metrics which couldn't be parsed or updated are skipped
+// and returned in errors of the response with their indexes in the request.
 func (g MetricsHandlers) UpdatesMetric(ctx context.Context, request *proto.UpdatesRequest) (*proto.UpdatesResponse, error) {
+	if !request.GetPartial() {
+		return g.updatesAll(ctx, request)
+	}
+
 	var response proto.UpdatesResponse
+	var batchError apierror.BatchError
 
-	var requestMetrics = make([]models.Metric, len(request.Metric))
+	requestMetrics := make([]models.Metric, 0, len(request.Metric))
+	indexes := make([]int, 0, len(request.Metric))
 	for i, metric := range request.Metric {
 		requestMetric, err := proto.ParseMetricFromRequest(metric)
 		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "couldn't parse metric from request: %s", err)
+			batchError.Add(i, metric.GetName(), err)
+			continue
 		}
 
-		requestMetrics[i] = *requestMetric
+		requestMetrics = append(requestMetrics, *requestMetric)
+		indexes = append(indexes, i)
 	}
 
-	if err := g.metricsUC.Updates(ctx, requestMetrics); err != nil {
-		return nil, status.Errorf(codes.Internal, "couldn't update metric: %s", err)
+	if len(requestMetrics) != 0 {
+		err := g.metricsUC.UpdatesPartial(ctx, requestMetrics)
+
+		var updateError *apierror.BatchError
+		if errors.As(err, &updateError) {
+			for _, item := range updateError.Items {
+				batchError.Add(indexes[item.Index], item.Name, item.Err)
+			}
+		} else if err != nil {
+			return nil, apierror.GRPCStatus(err)
+		}
+	}
+
+	sort.Slice(batchError.Items, func(i, j int) bool {
+		return batchError.Items[i].Index < batchError.Items[j].Index
+	})
+
+	for _, item := range apierror.NewItemProblems(&batchError) {
+		response.Errors = append(response.Errors, &proto.UpdateError{
+			Index:   int32(item.Index),
+			Name:    item.Name,
+			Code:    item.Code,
+			Message: item.Detail,
+		})
 	}
 
 	return &response, nil
 }
 
+// updatesAll stores all metrics of the request, the request is rejected if any metric is invalid.
+func (g MetricsHandlers) updatesAll(ctx context.Context, request *proto.UpdatesRequest) (*proto.UpdatesResponse, error) {
+	requestMetrics := make([]models.Metric, 0, len(request.Metric))
+	for _, metric := range request.Metric {
+		requestMetric, err := proto.ParseMetricFromRequest(metric)
+		if err != nil {
+			return nil, apierror.GRPCStatus(apierror.WithMetric(err, metric.GetName()))
+		}
+
+		requestMetrics = append(requestMetrics, *requestMetric)
+	}
+
+	if err := g.metricsUC.Updates(ctx, requestMetrics); err != nil {
+		return nil, apierror.GRPCStatus(err)
+	}
+
+	return &proto.UpdatesResponse{}, nil
+}
+
 func (g MetricsHandlers) ValueMetric(ctx context.Context, request *proto.ValueRequest) (*proto.ValueResponse, error) {
 	var response proto.ValueResponse
 
 	metricType, err := proto.ParseTypeFromRequest(request.Type)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "couldn't parse metric type from request: %s", err)
+		return nil, apierror.GRPCStatus(apierror.WithField(err, "type"))
 	}
 
-	foundMetric, err := g.metricsUC.Find(ctx, request.Name, metricType)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "couldn't find metric: %s", err)
+	var labels models.Labels
+	if len(request.Labels) != 0 {
+		labels = request.Labels
 	}
 
-	response.Metric = &proto.Metric{
-		Name:  foundMetric.Name,
-		Type:  proto.MetricType(foundMetric.MType.IntGrpc()),
-		Value: foundMetric.StringValue(),
-		Hash:  foundMetric.HashValue(g.config.HashKey),
+	foundMetric, err := g.metricsUC.Find(ctx, request.Name, metricType, labels)
+	if err != nil {
+		return nil, apierror.GRPCStatus(apierror.WithMetric(err, request.Name))
 	}
 
+	response.Metric = proto.NewMetric(*foundMetric, g.config.HashKey)
+
 	return &response, nil
 }
 
-func (g MetricsHandlers) ListMetrics(context.Context, *proto.ListRequest) (*proto.ListResponse, error) {
+func (g MetricsHandlers) ListMetrics(ctx context.Context, request *proto.ListRequest) (*proto.ListResponse, error) {
 	var response proto.ListResponse
 
-	metricsList, err := g.metricsUC.GetAll(context.Background())
+	matchers, err := proto.ParseLabelMatchersFromRequest(request.Matchers)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "couldn't list metrics: %s", err)
+		return nil, apierror.GRPCStatus(apierror.WithField(err, "matchers"))
+	}
+
+	metricsList, err := g.metricsUC.Select(ctx, matchers)
+	if err != nil {
+		return nil, apierror.GRPCStatus(err)
 	}
 
 	response.Metric = make([]*proto.Metric, len(metricsList))
 	for i, metric := range metricsList {
-		response.Metric[i] = &proto.Metric{
-			Name:  metric.Name,
-			Type:  proto.MetricType(metric.MType.IntGrpc()),
-			Value: metric.StringValue(),
-			Hash:  metric.HashValue(g.config.HashKey),
-		}
+		response.Metric[i] = proto.NewMetric(metric, g.config.HashKey)
+	}
+
+	return &response, nil
+}
+
+func (g MetricsHandlers) RangeMetric(ctx context.Context, request *proto.RangeRequest) (*proto.RangeResponse, error) {
+	var response proto.RangeResponse
+
+	metricType, err := proto.ParseTypeFromRequest(request.Type)
+	if err != nil {
+		return nil, apierror.GRPCStatus(apierror.WithField(err, "type"))
+	}
+
+	var labels models.Labels
+	if len(request.Labels) != 0 {
+		labels = request.Labels
+	}
+
+	var from, to time.Time
+	if request.From != nil {
+		from = request.From.AsTime()
+	}
+	if request.To != nil {
+		to = request.To.AsTime()
+	}
+
+	samples, err := g.metricsUC.Range(ctx, request.Name, metricType, labels, from, to)
+	if err != nil {
+		return nil, apierror.GRPCStatus(apierror.WithMetric(err, request.Name))
+	}
+
+	response.Samples = make([]*proto.Sample, len(samples))
+	for i, sample := range samples {
+		response.Samples[i] = proto.NewSample(sample)
 	}
 
 	return &response, nil
@@ -2,9 +2,6 @@ package http
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,6 +27,7 @@ func NewMetricsHandlers(metricsUC metrics.UseCase, config *config.ServerConfig)
 }
 
 // Find is a handler that finds models.Metric based on the parameters in the URL.
+// Labels of the metric are passed as query parameters.
 // If metric is not found 404 status code returned.
 // Otherwise, metric value is returned.
 func (m *MetricsHandlers) Find(w http.ResponseWriter, r *http.Request) {
@@ -43,9 +41,9 @@ func (m *MetricsHandlers) Find(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	metric, err := m.metricsUC.Find(ctx, urlData.MetricName, urlData.MetricType)
+	metric, err := m.metricsUC.Find(ctx, urlData.MetricName, urlData.MetricType, urlData.Labels)
 	if err != nil {
-		apierror.WriteHTTP(w, err)
+		apierror.WriteHTTP(w, apierror.WithMetric(err, urlData.MetricName))
 		if !errors.Is(err, apierror.NotFound) {
 			log.Printf("Couldn't get metric with error: %s", err)
 		}
@@ -66,14 +64,14 @@ func (m *MetricsHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 
 	if err != nil {
-		http.Error(w, "couldn't read body", http.StatusInternalServerError)
+		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't read body with error: %s", err)
 		return
 	}
 
 	var metric models.Metric
 	if err := json.Unmarshal(body, &metric); err != nil {
-		http.Error(w, "couldn't parse json", http.StatusBadRequest)
+		apierror.WriteHTTP(w, apierror.JSONError(err))
 		log.Printf("Couldn't parse json with error: %s", err)
 		return
 	}
@@ -81,9 +79,9 @@ func (m *MetricsHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	foundMetric, err := m.metricsUC.Find(ctx, metric.Name, metric.MType)
+	foundMetric, err := m.metricsUC.Find(ctx, metric.Name, metric.MType, metric.Labels)
 	if err != nil {
-		apierror.WriteHTTP(w, err)
+		apierror.WriteHTTP(w, apierror.WithMetric(err, metric.Name))
 		if !errors.Is(err, apierror.NotFound) {
 			log.Printf("Couldn't get metric with error: %s", err)
 		}
@@ -94,7 +92,7 @@ func (m *MetricsHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 
 	jsonFoundMetric, err := json.Marshal(foundMetric)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't marshal metric with error: %s", err)
 		return
 	}
@@ -102,7 +100,6 @@ func (m *MetricsHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(jsonFoundMetric)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Printf("Couldn't write response to FindJSON request with error: %s", err)
 		return
 	}
@@ -110,7 +107,53 @@ func (m *MetricsHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Got metric with name %s, value: %s, type: %s", foundMetric.Name, foundMetric.StringValue(), foundMetric.MType)
 }
 
+// rangeRequest is a body of Range request.
+type rangeRequest struct {
+	Name   string            `json:"id"`
+	MType  models.MetricType `json:"type"`
+	Labels models.Labels     `json:"labels,omitempty"`
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+}
+
+// Range is a handler that returns history of models.Metric series based on the json passed in request body.
+// If "to" is omitted, current time is used.
+// Samples are returned as json array sorted by timestamp.
+func (m *MetricsHandlers) Range(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't read body with error: %s", err)
+		return
+	}
+
+	var request rangeRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		apierror.WriteHTTP(w, apierror.JSONError(err))
+		log.Printf("Couldn't parse json with error: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	samples, err := m.metricsUC.Range(ctx, request.Name, request.MType, request.Labels, request.From, request.To)
+	if err != nil {
+		apierror.WriteHTTP(w, apierror.WithMetric(err, request.Name))
+		log.Printf("Couldn't get metric range with error: %s", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(samples); err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't encode json with error: %s", err)
+		return
+	}
+}
+
 // Update is a handler that updates models.Metric with given key based on the parameters in the URL.
+// Value of histogram metric is observed into models.DefaultHistogramBuckets.
 func (m *MetricsHandlers) Update(w http.ResponseWriter, r *http.Request) {
 	urlData, err := models.ParsePostURLData(r)
 	if err != nil {
@@ -123,15 +166,16 @@ func (m *MetricsHandlers) Update(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	metric := models.Metric{
-		Name:  urlData.MetricName,
-		MType: urlData.MetricType,
+		Name:   urlData.MetricName,
+		MType:  urlData.MetricType,
+		Labels: urlData.Labels,
 	}
 
 	switch urlData.MetricType {
 	case models.Gauge:
 		floatVal, err := strconv.ParseFloat(urlData.MetricValue, 64)
 		if err != nil {
-			apierror.WriteHTTP(w, apierror.NumberParse)
+			apierror.WriteHTTP(w, apierror.WithMetric(apierror.NumberParse, urlData.MetricName))
 			return
 		}
 
@@ -139,18 +183,27 @@ func (m *MetricsHandlers) Update(w http.ResponseWriter, r *http.Request) {
 	case models.Counter:
 		intVal, err := strconv.ParseInt(urlData.MetricValue, 10, 64)
 		if err != nil {
-			apierror.WriteHTTP(w, apierror.NumberParse)
+			apierror.WriteHTTP(w, apierror.WithMetric(apierror.NumberParse, urlData.MetricName))
 			return
 		}
 
 		metric.Delta = &intVal
+	case models.Histogram:
+		floatVal, err := strconv.ParseFloat(urlData.MetricValue, 64)
+		if err != nil {
+			apierror.WriteHTTP(w, apierror.WithMetric(apierror.NumberParse, urlData.MetricName))
+			return
+		}
+
+		metric.Histogram = models.NewHistogram(models.DefaultHistogramBuckets)
+		metric.Histogram.Observe(floatVal)
 	default:
-		apierror.WriteHTTP(w, apierror.UnknownMetricType)
+		apierror.WriteHTTP(w, apierror.WithMetric(apierror.UnknownMetricType, urlData.MetricName))
 		return
 	}
 
 	if err = m.metricsUC.Update(ctx, metric); err != nil {
-		apierror.WriteHTTP(w, err)
+		apierror.WriteHTTP(w, apierror.WithMetric(err, metric.Name))
 		log.Printf("Couldn't update metric with error: %s", err)
 		return
 	}
@@ -164,26 +217,14 @@ func (m *MetricsHandlers) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 
 	if err != nil {
-		http.Error(w, "couldn't read body", http.StatusInternalServerError)
+		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't read body with error: %s", err)
 		return
 	}
 
-	var decryptedJSON []byte
-	if m.config.CryptoKey != nil {
-		decryptedJSON, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, m.config.CryptoKey, body, nil)
-		if err != nil {
-			http.Error(w, "couldn't decrypt json", http.StatusInternalServerError)
-			log.Printf("couldn't decrypt json: %s", err)
-			return
-		}
-	} else {
-		decryptedJSON = body
-	}
-
 	var metric models.Metric
-	if err := json.Unmarshal(decryptedJSON, &metric); err != nil {
-		http.Error(w, "couldn't parse json", http.StatusBadRequest)
+	if err := json.Unmarshal(body, &metric); err != nil {
+		apierror.WriteHTTP(w, apierror.JSONError(err))
 		log.Printf("Couldn't parse json with error: %s", err)
 		return
 	}
@@ -192,7 +233,7 @@ func (m *MetricsHandlers) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if err := m.metricsUC.Update(ctx, metric); err != nil {
-		apierror.WriteHTTP(w, err)
+		apierror.WriteHTTP(w, apierror.WithMetric(err, metric.Name))
 		log.Printf("Couldn't update metric with error: %s", err)
 		return
 	}
@@ -202,30 +243,52 @@ func (m *MetricsHandlers) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	ctxGet, cancelGet := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancelGet()
 
-	newMetric, _ := m.metricsUC.Find(ctxGet, metric.Name, metric.MType)
+	newMetric, _ := m.metricsUC.Find(ctxGet, metric.Name, metric.MType, metric.Labels)
 	newMetric.Hash = newMetric.HashValue(m.config.HashKey)
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(newMetric)
 	if err != nil {
-		http.Error(w, "couldn't encode json", http.StatusInternalServerError)
+		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't encode json with error: %s", err)
 		return
 	}
 }
 
+// updatesResult is a body of Updates response if some metrics of the batch are skipped.
+type updatesResult struct {
+	Metrics []models.Metric        `json:"metrics"`
+	Errors  []apierror.ItemProblem `json:"errors"`
+}
+
 // Updates is a handler that updates []models.Metric based on the json in the request body.
+// Updated metrics are returned as json array. If some metrics are invalid, nothing is updated,
+// unless "partial" query parameter is true: then valid metrics are still updated
+// and 207 status code is returned with updated metrics and errors of skipped ones, see updatesResult.
 func (m *MetricsHandlers) Updates(w http.ResponseWriter, r *http.Request) {
+	update := m.metricsUC.Updates
+	if value := r.URL.Query().Get("partial"); len(value) != 0 {
+		partial, err := strconv.ParseBool(value)
+		if err != nil {
+			apierror.WriteHTTP(w, apierror.WithField(apierror.InvalidValue, "partial"))
+			log.Printf("Couldn't parse partial parameter with error: %s", err)
+			return
+		}
+		if partial {
+			update = m.metricsUC.UpdatesPartial
+		}
+	}
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "couldn't read body", http.StatusInternalServerError)
+		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't read body with error: %s", err)
 		return
 	}
 
 	var metricSlice []models.Metric
 	if err := json.Unmarshal(body, &metricSlice); err != nil {
-		http.Error(w, "couldn't parse json", http.StatusBadRequest)
+		apierror.WriteHTTP(w, apierror.JSONError(err))
 		log.Printf("Couldn't parse json with error: %s", err)
 		return
 	}
@@ -233,35 +296,54 @@ func (m *MetricsHandlers) Updates(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	if err := m.metricsUC.Updates(ctx, metricSlice); err != nil {
+	var batchError *apierror.BatchError
+	if err := update(ctx, metricSlice); err != nil && !errors.As(err, &batchError) {
 		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't update metric with error: %s", err)
 		return
 	}
 
-	log.Printf("Updates %d metrics", len(metricSlice))
+	skipped := make(map[int]struct{})
+	if batchError != nil {
+		log.Printf("Couldn't update some metrics with error: %s", batchError)
+		for _, item := range batchError.Items {
+			skipped[item.Index] = struct{}{}
+		}
+	}
+
+	log.Printf("Updates %d metrics", len(metricSlice)-len(skipped))
 
 	updatedMetrics := make([]models.Metric, 0, len(metricSlice))
 
 	ctxGet, cancelGet := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancelGet()
 
-	for _, metric := range metricSlice {
-		newMetric, _ := m.metricsUC.Find(ctxGet, metric.Name, metric.MType)
+	for i, metric := range metricSlice {
+		if _, ok := skipped[i]; ok {
+			continue
+		}
+
+		newMetric, _ := m.metricsUC.Find(ctxGet, metric.Name, metric.MType, metric.Labels)
 		newMetric.Hash = newMetric.HashValue(m.config.HashKey)
 		updatedMetrics = append(updatedMetrics, *newMetric)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(updatedMetrics)
+	if batchError != nil {
+		w.WriteHeader(http.StatusMultiStatus)
+		err = json.NewEncoder(w).Encode(updatesResult{Metrics: updatedMetrics, Errors: apierror.NewItemProblems(batchError)})
+	} else {
+		err = json.NewEncoder(w).Encode(updatedMetrics)
+	}
 	if err != nil {
-		http.Error(w, "couldn't encode json", http.StatusInternalServerError)
+		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't encode json with error: %s", err)
 		return
 	}
 }
 
 // GetAll returns list of all metrics stored on repository.
+// Metrics can be filtered with label matchers passed in "match" query parameter, e.g. /?match={host="a",region=~"eu-.*"}.
 func (m *MetricsHandlers) GetAll(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 	getHashSubstring := func(metric models.Metric) string {
@@ -272,10 +354,17 @@ func (m *MetricsHandlers) GetAll(w http.ResponseWriter, r *http.Request) {
 		return fmt.Sprintf(", hash: %s", metric.Hash)
 	}
 
+	matchers, err := models.ParseLabelMatchers(r.URL.Query().Get("match"))
+	if err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't parse label matchers with error: %s", err)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	all, err := m.metricsUC.GetAll(ctx)
+	all, err := m.metricsUC.Select(ctx, matchers)
 	if err != nil {
 		apierror.WriteHTTP(w, err)
 		log.Printf("Couldn't get all metrics with error: %s", err)
@@ -287,7 +376,7 @@ func (m *MetricsHandlers) GetAll(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, v := range all {
-		_, err := w.Write([]byte(fmt.Sprintf("Key: %s, value: %s, type: %s%s \n", v.Name, v.StringValue(), v.MType, getHashSubstring(v))))
+		_, err := w.Write([]byte(fmt.Sprintf("Key: %s%s, value: %s, type: %s%s \n", v.Name, v.Labels.String(), v.StringValue(), v.MType, getHashSubstring(v))))
 		if err != nil {
 			log.Printf("Couldn't write response to GetAll request with error: %s", err)
 		}
@@ -9,7 +9,9 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +22,7 @@ import (
 	"go-metricscol/internal/config"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/server/apierror"
 	"go-metricscol/internal/server/metrics/usecase"
 	"go-metricscol/internal/utils"
 )
@@ -86,7 +89,7 @@ func TestMetricsHandlers_Find(t *testing.T) {
 			},
 			want: want{
 				StatusCode: http.StatusNotFound,
-				Body:       "",
+				Body:       `{"type":"about:blank","title":"Not Found","status":404,"detail":"not found","code":"not_found","metric":"NewMetric"}` + "\n",
 			},
 		},
 		{
@@ -97,7 +100,7 @@ func TestMetricsHandlers_Find(t *testing.T) {
 			},
 			want: want{
 				StatusCode: http.StatusNotImplemented,
-				Body:       "",
+				Body:       `{"type":"about:blank","title":"Not Implemented","status":501,"detail":"unknown metric type","code":"unknown_metric_type"}` + "\n",
 			},
 		},
 	}
@@ -211,6 +214,63 @@ func TestMetricsHandlers_GetAll(t *testing.T) {
 	}
 }
 
+func TestMetricsHandlers_GetAllWithMatchers(t *testing.T) {
+	storage := memory.NewMemStorage()
+	h := NewMetricsHandlers(usecase.NewMetricsUC(storage, emptyConfig), emptyConfig)
+
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:   "Alloc",
+		MType:  models.Gauge,
+		Value:  utils.Ptr(1.0),
+		Labels: models.Labels{"host": "web1"},
+	}))
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:   "Alloc",
+		MType:  models.Gauge,
+		Value:  utils.Ptr(2.0),
+		Labels: models.Labels{"host": "web2"},
+	}))
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "Without matchers",
+			url:        "/",
+			statusCode: http.StatusOK,
+			body: "Key: Alloc{host=\"web1\"}, value: 1, type: gauge \n" +
+				"Key: Alloc{host=\"web2\"}, value: 2, type: gauge \n",
+		},
+		{
+			name:       "With matcher",
+			url:        "/?match=" + url.QueryEscape(`{host="web2"}`),
+			statusCode: http.StatusOK,
+			body:       "Key: Alloc{host=\"web2\"}, value: 2, type: gauge \n",
+		},
+		{
+			name:       "Invalid matcher",
+			url:        "/?match=" + url.QueryEscape(`{host=web2}`),
+			statusCode: http.StatusBadRequest,
+			body:       `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid labels","code":"invalid_labels"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.GetAll).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+		})
+	}
+}
+
 func ExampleMetricsHandlers_GetAll() {
 	address := "localhost:8080"
 
@@ -699,6 +759,18 @@ func TestMetricsHandlers_UpdateJSON(t *testing.T) {
 				StatusCode: http.StatusOK,
 			},
 		},
+		{
+			name: "Update histogram",
+			body: `{"id": "Latency", "type": "histogram", "histogram": {"bounds": [0.1, 1], "counts": [2, 1, 0], "sum": 0.7}}`,
+			want: want{
+				Body: models.Metric{
+					Name:      "Latency",
+					MType:     models.Histogram,
+					Histogram: &models.HistogramValue{Bounds: []float64{0.1, 1}, Counts: []uint64{2, 1, 0}, Sum: 0.7},
+				},
+				StatusCode: http.StatusOK,
+			},
+		},
 		{
 			name: "Update unknown type",
 			body: `{"id": "Alloc", "type": "unknown", "value": 13.1}`,
@@ -706,6 +778,13 @@ func TestMetricsHandlers_UpdateJSON(t *testing.T) {
 				StatusCode: http.StatusNotImplemented,
 			},
 		},
+		{
+			name: "Update with invalid label name",
+			body: `{"id": "Alloc", "type": "gauge", "value": 13.1, "labels": {"1host": "web1"}}`,
+			want: want{
+				StatusCode: http.StatusBadRequest,
+			},
+		},
 	}
 	for _, tt := range tests {
 		storage := memory.NewMemStorage()
@@ -731,12 +810,14 @@ func TestMetricsHandlers_UpdateJSON(t *testing.T) {
 			handler.ServeHTTP(rr, req)
 
 			assert.Equal(t, tt.want.StatusCode, rr.Code)
-			if rr.Code == http.StatusOK {
-				got, _ := storage.GetAll(context.Background())
-				require.Equal(t, 1, len(got))
-
-				assert.True(t, reflect.DeepEqual(tt.want.Body, got[0]))
+			got, _ := storage.GetAll(context.Background())
+			if rr.Code != http.StatusOK {
+				assert.Empty(t, got)
+				return
 			}
+
+			require.Equal(t, 1, len(got))
+			assert.True(t, reflect.DeepEqual(tt.want.Body, got[0]))
 		})
 	}
 }
@@ -876,3 +957,90 @@ func TestMetricsHandlers_Updates(t *testing.T) {
 	}
 	response.Body.Close()
 }
+
+func TestMetricsHandlers_UpdatesPartial(t *testing.T) {
+	storage := memory.NewMemStorage()
+	h := NewMetricsHandlers(usecase.NewMetricsUC(storage, nil), &config.ServerConfig{})
+
+	body := `[
+		{"id": "Alloc", "type": "gauge", "value": 1},
+		{"id": "PollCount", "type": "counter", "value": 1.5},
+		{"id": "metricscol_up", "type": "gauge", "value": 1},
+		{"id": "Frees", "type": "counter", "delta": 2}
+	]`
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.Updates).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/?partial=true", strings.NewReader(body)))
+	require.Equal(t, http.StatusMultiStatus, rr.Code)
+
+	var result updatesResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+
+	require.Len(t, result.Metrics, 2)
+	assert.Equal(t, "Alloc", result.Metrics[0].Name)
+	assert.Equal(t, "Frees", result.Metrics[1].Name)
+
+	assert.Equal(t, []apierror.ItemProblem{
+		{Index: 1, Name: "PollCount", Status: http.StatusBadRequest, Code: "invalid_value", Detail: "invalid value"},
+		{Index: 2, Name: "metricscol_up", Status: http.StatusBadRequest, Code: "reserved_metric_name", Detail: "metric name prefix is reserved for server metrics"},
+	}, result.Errors)
+
+	_, err := storage.Get(context.Background(), "Frees", models.Counter, nil)
+	assert.NoError(t, err)
+	_, err = storage.Get(context.Background(), "PollCount", models.Counter, nil)
+	assert.ErrorIs(t, err, apierror.NotFound)
+}
+
+func TestMetricsHandlers_UpdatesInvalid(t *testing.T) {
+	storage := memory.NewMemStorage()
+	h := NewMetricsHandlers(usecase.NewMetricsUC(storage, nil), &config.ServerConfig{})
+
+	body := `[
+		{"id": "Alloc", "type": "gauge", "value": 1},
+		{"id": "PollCount", "type": "counter", "value": 1.5}
+	]`
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.Updates).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Batch is applied at once or not at all without partial parameter.
+	all, err := storage.GetAll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.Updates).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/?partial=yes", strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMetricsHandlers_SeriesLimits(t *testing.T) {
+	cfg, err := config.NewServerConfig("", models.Duration{Duration: time.Second}, "", false, "", "", "", "")
+	require.NoError(t, err)
+	cfg.MaxSeries = 2
+	cfg.MaxNewSeriesPerMinute = 1
+
+	h := NewMetricsHandlers(usecase.NewMetricsUC(memory.NewMemStorage(), cfg), cfg)
+	r := chi.NewRouter()
+	r.Post("/update/{type}/{name}/{value}", h.Update)
+	r.Get("/metrics", h.Prometheus)
+
+	update := func(name string) int {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/update/gauge/"+name+"/1", nil))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, update("first"))
+	assert.Equal(t, http.StatusTooManyRequests, update("second"), "new series rate limit")
+	assert.Equal(t, http.StatusOK, update("first"), "existing series are not limited")
+
+	cfg.MaxNewSeriesPerMinute = 0
+	assert.Equal(t, http.StatusOK, update("second"))
+	assert.Equal(t, http.StatusInsufficientStorage, update("third"), "series limit")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rr.Body.String(), `metricscol_rejected_writes_total{reason="max_series"} 1`)
+	assert.Contains(t, rr.Body.String(), `metricscol_rejected_writes_total{reason="new_series_rate"} 1`)
+}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/server/apierror"
+)
+
+// InfluxWrite is a handler that stores metrics sent in InfluxDB line protocol, e.g. "cpu,host=a usage=0.5,count=3i".
+// Every field becomes a metric named measurement_field with tags as labels.
+// Numeric and boolean fields are stored as gauges and string fields are skipped.
+// Integer fields are gauges too, because line protocol fields are absolute values:
+// storing them as counters would add the same value again on every write.
+// Timestamps are validated, but samples are recorded with the server time.
+func (m *MetricsHandlers) InfluxWrite(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't read body with error: %s", err)
+		return
+	}
+
+	metricSlice, err := parseLineProtocol(string(body))
+	if err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't parse line protocol with error: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	if err := m.metricsUC.Updates(ctx, metricSlice); err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't update metrics with error: %s", err)
+		return
+	}
+
+	log.Printf("Updates %d metrics from line protocol", len(metricSlice))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseLineProtocol parses batch of InfluxDB line protocol lines.
+// If any line is invalid, apierror.InvalidLineProtocol is returned.
+func parseLineProtocol(body string) ([]models.Metric, error) {
+	result := make([]models.Metric, 0)
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		metrics, err := parseLineProtocolLine(line)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, metrics...)
+	}
+
+	return result, nil
+}
+
+func parseLineProtocolLine(line string) ([]models.Metric, error) {
+	sections := splitUnescaped(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, apierror.InvalidLineProtocol
+	}
+
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return nil, apierror.InvalidLineProtocol
+		}
+	}
+
+	keys := splitUnescaped(sections[0], ',')
+	measurement := unescapeLineProtocol(keys[0])
+	if len(measurement) == 0 {
+		return nil, apierror.InvalidLineProtocol
+	}
+
+	var labels models.Labels
+	for _, tag := range keys[1:] {
+		pair := splitUnescaped(tag, '=')
+		if len(pair) != 2 || len(pair[0]) == 0 {
+			return nil, apierror.InvalidLineProtocol
+		}
+
+		if labels == nil {
+			labels = models.Labels{}
+		}
+		labels[unescapeLineProtocol(pair[0])] = unescapeLineProtocol(pair[1])
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	var result []models.Metric
+	for _, field := range splitUnescaped(sections[1], ',') {
+		key, value, found := cutUnescaped(field, '=')
+		if !found || len(key) == 0 || len(value) == 0 {
+			return nil, apierror.InvalidLineProtocol
+		}
+
+		metric := models.Metric{
+			Name:   measurement + "_" + unescapeLineProtocol(key),
+			Labels: labels,
+		}
+
+		switch {
+		case value[0] == '"':
+			// String fields have no numeric representation.
+			continue
+		case value[len(value)-1] == 'i':
+			integer, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+			if err != nil {
+				return nil, apierror.InvalidLineProtocol
+			}
+			gauge := float64(integer)
+			metric.MType = models.Gauge
+			metric.Value = &gauge
+		case value[len(value)-1] == 'u':
+			unsigned, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+			if err != nil {
+				return nil, apierror.InvalidLineProtocol
+			}
+			gauge := float64(unsigned)
+			metric.MType = models.Gauge
+			metric.Value = &gauge
+		default:
+			gauge, err := parseLineProtocolFloat(value)
+			if err != nil {
+				return nil, err
+			}
+			metric.MType = models.Gauge
+			metric.Value = &gauge
+		}
+
+		result = append(result, metric)
+	}
+
+	return result, nil
+}
+
+// parseLineProtocolFloat parses float or boolean field value, booleans are converted to 1 and 0.
+func parseLineProtocolFloat(value string) (float64, error) {
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, apierror.InvalidLineProtocol
+	}
+
+	return result, nil
+}
+
+// splitUnescaped splits s by separator which is not escaped with backslash and not inside double quotes.
+func splitUnescaped(s string, sep byte) []string {
+	var result []string
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(result, s[start:])
+}
+
+// cutUnescaped slices s around the first unescaped separator.
+func cutUnescaped(s string, sep byte) (before string, after string, found bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+var lineProtocolUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\"`, `"`, `\\`, `\`)
+
+func unescapeLineProtocol(s string) string {
+	return lineProtocolUnescaper.Replace(s)
+}
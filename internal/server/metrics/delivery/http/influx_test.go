@@ -0,0 +1,134 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/server/apierror"
+	healthUseCase "go-metricscol/internal/server/health/usecase"
+	"go-metricscol/internal/server/metrics/usecase"
+	"go-metricscol/internal/server/middleware"
+	"go-metricscol/internal/utils"
+)
+
+func Test_parseLineProtocol(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []models.Metric
+		err   error
+	}{
+		{
+			name:  "Fields of different types",
+			input: "cpu,host=web1,region=eu usage=0.5,count=3i,up=t,state=\"ok, fine\" 1690000000000000000",
+			want: []models.Metric{
+				{Name: "cpu_usage", MType: models.Gauge, Value: utils.Ptr(0.5), Labels: models.Labels{"host": "web1", "region": "eu"}},
+				{Name: "cpu_count", MType: models.Gauge, Value: utils.Ptr(3.0), Labels: models.Labels{"host": "web1", "region": "eu"}},
+				{Name: "cpu_up", MType: models.Gauge, Value: utils.Ptr(1.0), Labels: models.Labels{"host": "web1", "region": "eu"}},
+			},
+		},
+		{
+			name:  "Escaped measurement and tag value, without timestamp",
+			input: "disk\\ io,path=/var\\ log free=10u\n\n# comment\nmem used=1e3",
+			want: []models.Metric{
+				{Name: "disk io_free", MType: models.Gauge, Value: utils.Ptr(10.0), Labels: models.Labels{"path": "/var log"}},
+				{Name: "mem_used", MType: models.Gauge, Value: utils.Ptr(1000.0)},
+			},
+		},
+		{
+			name:  "Without fields",
+			input: "cpu,host=web1",
+			err:   apierror.InvalidLineProtocol,
+		},
+		{
+			name:  "Invalid integer",
+			input: "cpu count=3.5i",
+			err:   apierror.InvalidLineProtocol,
+		},
+		{
+			name:  "Invalid timestamp",
+			input: "cpu usage=1 yesterday",
+			err:   apierror.InvalidLineProtocol,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLineProtocol(tt.input)
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMetricsHandlers_InfluxWrite(t *testing.T) {
+	cfg, err := config.NewServerConfig("", models.Duration{Duration: time.Second}, "", false, "", "", "", "192.168.0.0/24")
+	require.NoError(t, err)
+
+	storage := memory.NewMemStorage()
+	metricsUC := usecase.NewMetricsUC(storage, cfg)
+	mw := middleware.NewManager(metricsUC, healthUseCase.NewHealthUC(storage), cfg, storage)
+
+	r := chi.NewRouter()
+	r.Use(mw.DecompressHandler)
+	r.Use(mw.HTTPTrustedSubnetHandler)
+	MapMetricsRoutes(r, NewMetricsHandlers(metricsUC, cfg), mw)
+
+	body := bytes.NewBuffer([]byte{})
+	writer := gzip.NewWriter(body)
+	_, err = writer.Write([]byte("cpu,host=web1 usage=0.5,count=3i"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	tests := []struct {
+		name       string
+		realIP     string
+		statusCode int
+	}{
+		{
+			name:       "Untrusted subnet",
+			realIP:     "10.0.0.1",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Gzipped batch",
+			realIP:     "192.168.0.10",
+			statusCode: http.StatusNoContent,
+		}, {
+			name:       "Repeated batch",
+			realIP:     "192.168.0.10",
+			statusCode: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/write", bytes.NewReader(body.Bytes()))
+			require.NoError(t, err)
+			req.Header.Set("Content-Encoding", "gzip")
+			req.Header.Set("X-Real-IP", tt.realIP)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+
+	// Integer fields are stored as gauges, so repeated writes don't accumulate.
+	metric, err := storage.Get(context.Background(), "cpu_count", models.Gauge, models.Labels{"host": "web1"})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, *metric.Value)
+}
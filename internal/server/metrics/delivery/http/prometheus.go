@@ -0,0 +1,144 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/server/apierror"
+)
+
+// prometheusContentType is a content type of Prometheus text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prometheus is a handler that renders all metrics stored on repository in Prometheus text exposition format.
+// Metrics of the server itself with instrument.Prefix are rendered after them.
+// Metrics names are sanitized to valid Prometheus identifiers.
+func (m *MetricsHandlers) Prometheus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	all, err := m.metricsUC.GetAll(ctx)
+	if err != nil {
+		apierror.WriteHTTP(w, err)
+		log.Printf("Couldn't get all metrics with error: %s", err)
+		return
+	}
+
+	if m.config != nil {
+		all = append(all, m.config.Instruments().Metrics()...)
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	if err := writePrometheus(w, all); err != nil {
+		log.Printf("Couldn't write response to Prometheus request with error: %s", err)
+	}
+}
+
+// writePrometheus writes metrics grouped by sanitized name, every group is preceded by # TYPE line.
+func writePrometheus(w io.Writer, metrics []models.Metric) error {
+	var names []string
+	families := map[string][]models.Metric{}
+	for _, metric := range metrics {
+		name := sanitizePrometheusName(metric.Name)
+		if _, ok := families[name]; !ok {
+			names = append(names, name)
+		}
+		families[name] = append(families[name], metric)
+	}
+
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, family[0].MType)
+
+		for _, metric := range family {
+			// Family has single type, metrics of other types with the same name are skipped.
+			if metric.MType != family[0].MType {
+				continue
+			}
+
+			switch metric.MType {
+			case models.Gauge, models.Counter:
+				fmt.Fprintf(buf, "%s%s %s\n", name, prometheusLabels(metric.Labels, "", ""), metric.StringValue())
+			case models.Histogram:
+				if metric.Histogram == nil {
+					continue
+				}
+
+				var cumulative uint64
+				for i, count := range metric.Histogram.Counts {
+					cumulative += count
+
+					le := "+Inf"
+					if i < len(metric.Histogram.Bounds) {
+						le = formatPrometheusFloat(metric.Histogram.Bounds[i])
+					}
+					fmt.Fprintf(buf, "%s_bucket%s %d\n", name, prometheusLabels(metric.Labels, "le", le), cumulative)
+				}
+				fmt.Fprintf(buf, "%s_sum%s %s\n", name, prometheusLabels(metric.Labels, "", ""), formatPrometheusFloat(metric.Histogram.Sum))
+				fmt.Fprintf(buf, "%s_count%s %d\n", name, prometheusLabels(metric.Labels, "", ""), cumulative)
+			}
+		}
+	}
+
+	return buf.Flush()
+}
+
+// sanitizePrometheusName replaces characters which are not allowed in Prometheus metric name with underscore.
+// Name starting with a digit is prefixed with underscore.
+func sanitizePrometheusName(name string) string {
+	result := []byte(name)
+	for i, c := range result {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == ':'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit {
+			result[i] = '_'
+		}
+	}
+
+	if len(result) == 0 || (result[0] >= '0' && result[0] <= '9') {
+		return "_" + string(result)
+	}
+
+	return string(result)
+}
+
+// prometheusLabelEscaper escapes label value as required by Prometheus text format.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabels returns labels sorted by name in Prometheus format.
+// If extraName is not empty, extra label is appended at the end, e.g. "le" label of histogram bucket.
+func prometheusLabels(labels models.Labels, extraName string, extraValue string) string {
+	if len(labels) == 0 && len(extraName) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, prometheusLabelEscaper.Replace(labels[name])))
+	}
+	if len(extraName) != 0 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, prometheusLabelEscaper.Replace(extraValue)))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatPrometheusFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
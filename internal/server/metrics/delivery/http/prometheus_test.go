@@ -0,0 +1,79 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/server/metrics/usecase"
+	"go-metricscol/internal/utils"
+)
+
+func TestMetricsHandlers_Prometheus(t *testing.T) {
+	storage := memory.NewMemStorage()
+	h := NewMetricsHandlers(usecase.NewMetricsUC(storage, emptyConfig), emptyConfig)
+
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:   "Alloc",
+		MType:  models.Gauge,
+		Value:  utils.Ptr(1.5),
+		Labels: models.Labels{"host": "web\"1"},
+	}))
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:  "PollCount",
+		MType: models.Counter,
+		Delta: utils.Ptr(int64(3)),
+	}))
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:  "http.latency",
+		MType: models.Histogram,
+		Histogram: &models.HistogramValue{
+			Bounds: []float64{0.1, 1},
+			Counts: []uint64{1, 2, 1},
+			Sum:    3.5,
+		},
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.Prometheus).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, prometheusContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE Alloc gauge\n"+
+		"Alloc{host=\"web\\\"1\"} 1.5\n"+
+		"# TYPE PollCount counter\n"+
+		"PollCount 3\n"+
+		"# TYPE http_latency histogram\n"+
+		"http_latency_bucket{le=\"0.1\"} 1\n"+
+		"http_latency_bucket{le=\"1\"} 3\n"+
+		"http_latency_bucket{le=\"+Inf\"} 4\n"+
+		"http_latency_sum 3.5\n"+
+		"http_latency_count 4\n", rr.Body.String())
+}
+
+func Test_sanitizePrometheusName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Alloc", want: "Alloc"},
+		{name: "http.requests-total", want: "http_requests_total"},
+		{name: "9lives", want: "_9lives"},
+		{name: "ns:metric", want: "ns:metric"},
+		{name: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizePrometheusName(tt.name))
+		})
+	}
+}
@@ -3,16 +3,20 @@ package http
 import (
 	"github.com/go-chi/chi"
 
+	"go-metricscol/internal/auth"
 	"go-metricscol/internal/server/metrics"
 	"go-metricscol/internal/server/middleware"
 )
 
 func MapMetricsRoutes(r *chi.Mux, h metrics.HTTPHandlers, mw *middleware.Manager) {
-	r.Get("/value/{type}/{name}", h.Find)
-	r.Post("/value/", h.FindJSON)
-	r.Post("/update/{type}/{name}/{value}", mw.DiskSaverHTTPMiddleware(h.Update))
-	r.Post("/update/", mw.ValidateHashHandler(mw.DiskSaverHTTPMiddleware(h.UpdateJSON)))
-	r.Post("/updates/", mw.ValidateHashesHandler(mw.DiskSaverHTTPMiddleware(h.Updates)))
+	r.Get("/value/{type}/{name}", mw.RequireRole(auth.Reader, h.Find))
+	r.Post("/value/", mw.RequireRole(auth.Reader, h.FindJSON))
+	r.Post("/range/", mw.RequireRole(auth.Reader, h.Range))
+	r.Get("/metrics", mw.RequireRole(auth.Reader, h.Prometheus))
+	r.Post("/update/{type}/{name}/{value}", mw.RequireRole(auth.Writer, mw.DiskSaverHTTPMiddleware(h.Update)))
+	r.Post("/update/", mw.RequireRole(auth.Writer, mw.DecryptHandler(mw.ValidateHashHandler(mw.DiskSaverHTTPMiddleware(h.UpdateJSON)))))
+	r.Post("/updates/", mw.RequireRole(auth.Writer, mw.DecryptHandler(mw.ValidateHashesHandler(mw.DiskSaverHTTPMiddleware(h.Updates)))))
+	r.Post("/write", mw.RequireRole(auth.Writer, mw.DiskSaverHTTPMiddleware(h.InfluxWrite)))
 
-	r.HandleFunc("/", h.GetAll)
+	r.HandleFunc("/", mw.RequireRole(auth.Reader, h.GetAll))
 }
@@ -0,0 +1,149 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/server/metrics"
+)
+
+// MetricsHandlers aggregates StatsD samples between flushes.
+// Counters are summed, the last gauge value is kept and timers are observed into histogram.
+type MetricsHandlers struct {
+	metricsUC metrics.UseCase
+	config    *config.ServerConfig
+
+	mu      sync.Mutex
+	pending map[string]*aggregate
+}
+
+// aggregate is a state of a single series between flushes.
+type aggregate struct {
+	metric models.Metric
+	// relative is true if gauge was only adjusted by signed values, so current stored value is used as a base.
+	relative bool
+}
+
+func NewMetricsHandlers(metricsUC metrics.UseCase, config *config.ServerConfig) *MetricsHandlers {
+	return &MetricsHandlers{metricsUC: metricsUC, config: config, pending: map[string]*aggregate{}}
+}
+
+// Handle parses StatsD packet which may contain multiple lines.
+// Invalid lines are logged and skipped.
+func (m *MetricsHandlers) Handle(packet []byte) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		sample, err := ParseLine(line)
+		if err != nil {
+			log.Printf("Couldn't parse statsd line with error: %s", err)
+			continue
+		}
+
+		m.add(*sample)
+	}
+}
+
+func (m *MetricsHandlers) add(sample Sample) {
+	mType := models.Gauge
+	switch sample.Type {
+	case Counter:
+		mType = models.Counter
+	case Timer, Histogram:
+		mType = models.Histogram
+	}
+
+	key := string(mType) + ":" + sample.Name + sample.Labels.String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agg, ok := m.pending[key]
+	if !ok {
+		agg = &aggregate{metric: models.Metric{Name: sample.Name, MType: mType, Labels: sample.Labels}}
+		m.pending[key] = agg
+	}
+
+	switch sample.Type {
+	case Counter:
+		delta := int64(math.Round(sample.Value / sample.SampleRate))
+		if agg.metric.Delta == nil {
+			agg.metric.Delta = &delta
+		} else {
+			*agg.metric.Delta += delta
+		}
+	case Gauge:
+		value := sample.Value
+		if sample.Relative && agg.metric.Value != nil {
+			value += *agg.metric.Value
+		}
+		if agg.metric.Value == nil {
+			agg.relative = sample.Relative
+		} else if !sample.Relative {
+			agg.relative = false
+		}
+		agg.metric.Value = &value
+	case Timer, Histogram:
+		if agg.metric.Histogram == nil {
+			agg.metric.Histogram = models.NewHistogram(models.DefaultHistogramBuckets)
+		}
+
+		value := sample.Value
+		// Timers are sent in milliseconds, while default buckets are in seconds.
+		if sample.Type == Timer {
+			value /= 1000
+		}
+
+		observations := int(math.Max(1, math.Round(1/sample.SampleRate)))
+		for i := 0; i < observations; i++ {
+			agg.metric.Histogram.Observe(value)
+		}
+	}
+}
+
+// Flush writes aggregated metrics with metrics.UseCase Updates and resets aggregation.
+func (m *MetricsHandlers) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = map[string]*aggregate{}
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]models.Metric, 0, len(pending))
+	for _, key := range keys {
+		agg := pending[key]
+		if agg.relative {
+			current, err := m.metricsUC.Find(ctx, agg.metric.Name, agg.metric.MType, agg.metric.Labels)
+			if err != nil && !errors.Is(err, apierror.NotFound) {
+				return err
+			}
+			if err == nil && current.Value != nil {
+				*agg.metric.Value += *current.Value
+			}
+		}
+
+		result = append(result, agg.metric)
+	}
+
+	return m.metricsUC.Updates(ctx, result)
+}
@@ -0,0 +1,63 @@
+package statsd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/repository/memory"
+	"go-metricscol/internal/server/metrics/usecase"
+	"go-metricscol/internal/utils"
+)
+
+func TestMetricsHandlers_Flush(t *testing.T) {
+	cfg, err := config.NewServerConfig("", models.Duration{Duration: time.Second}, "", false, "", "", "", "")
+	require.NoError(t, err)
+
+	storage := memory.NewMemStorage()
+	require.NoError(t, storage.Update(context.Background(), models.Metric{
+		Name:  "queue",
+		MType: models.Gauge,
+		Value: utils.Ptr(10.0),
+	}))
+
+	h := NewMetricsHandlers(usecase.NewMetricsUC(storage, cfg), cfg)
+
+	h.Handle([]byte("requests:1|c\nrequests:2|c|@0.5\n" +
+		"temperature:3|g\ntemperature:+1|g\n" +
+		"queue:-4|g\n" +
+		"latency:120|ms\nlatency:7000|ms\n" +
+		"broken line\n"))
+
+	require.NoError(t, h.Flush(context.Background()))
+
+	requests, err := storage.Get(context.Background(), "requests", models.Counter, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *requests.Delta)
+
+	temperature, err := storage.Get(context.Background(), "temperature", models.Gauge, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, *temperature.Value)
+
+	queue, err := storage.Get(context.Background(), "queue", models.Gauge, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 6.0, *queue.Value)
+
+	latency, err := storage.Get(context.Background(), "latency", models.Histogram, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), latency.Histogram.Count())
+	assert.InDelta(t, 7.12, latency.Histogram.Sum, 1e-9)
+
+	t.Run("Flush resets aggregation", func(t *testing.T) {
+		require.NoError(t, h.Flush(context.Background()))
+
+		requests, err := storage.Get(context.Background(), "requests", models.Counter, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), *requests.Delta)
+	})
+}
@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go-metricscol/internal/models"
+)
+
+// Type is a type of StatsD metric.
+type Type string
+
+// Declaration of supported StatsD metric types.
+const (
+	Counter   Type = "c"
+	Gauge     Type = "g"
+	Timer     Type = "ms"
+	Histogram Type = "h"
+)
+
+// Sample is a single parsed StatsD line.
+type Sample struct {
+	Name       string
+	Type       Type
+	Value      float64
+	Relative   bool    // значение gauge со знаком изменяет текущее значение
+	SampleRate float64 // доля отправленных значений, от 0 до 1
+	Labels     models.Labels
+}
+
+// ParseLine parses StatsD line in format "name:value|type[|@rate][|#tag:value,...]".
+// DogStatsD tags are converted to labels.
+func ParseLine(line string) (*Sample, error) {
+	name, rest, found := strings.Cut(line, ":")
+	if !found || len(name) == 0 {
+		return nil, fmt.Errorf("invalid statsd line %q", line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid statsd line %q", line)
+	}
+
+	sample := Sample{Name: name, Type: Type(parts[1]), SampleRate: 1}
+	switch sample.Type {
+	case Counter, Gauge, Timer, Histogram:
+	default:
+		return nil, fmt.Errorf("unsupported statsd type %q", parts[1])
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statsd value %q: %s", parts[0], err)
+	}
+	sample.Value = value
+	sample.Relative = sample.Type == Gauge && (parts[0][0] == '+' || parts[0][0] == '-')
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid statsd sample rate %q", part)
+			}
+			sample.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+			labels, err := parseTags(part[1:])
+			if err != nil {
+				return nil, err
+			}
+			sample.Labels = labels
+		default:
+			return nil, fmt.Errorf("invalid statsd line %q", line)
+		}
+	}
+
+	return &sample, nil
+}
+
+// parseTags parses DogStatsD tags in format "key:value,key2:value2".
+func parseTags(input string) (models.Labels, error) {
+	labels := models.Labels{}
+	for _, tag := range strings.Split(input, ",") {
+		name, value, _ := strings.Cut(tag, ":")
+		labels[name] = value
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
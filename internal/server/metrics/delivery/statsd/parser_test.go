@@ -0,0 +1,77 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/models"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *Sample
+		wantErr bool
+	}{
+		{
+			name: "Counter",
+			line: "requests:1|c",
+			want: &Sample{Name: "requests", Type: Counter, Value: 1, SampleRate: 1},
+		},
+		{
+			name: "Counter with sample rate",
+			line: "requests:1|c|@0.5",
+			want: &Sample{Name: "requests", Type: Counter, Value: 1, SampleRate: 0.5},
+		},
+		{
+			name: "Gauge",
+			line: "temperature:3.2|g",
+			want: &Sample{Name: "temperature", Type: Gauge, Value: 3.2, SampleRate: 1},
+		},
+		{
+			name: "Relative gauge",
+			line: "temperature:-1|g",
+			want: &Sample{Name: "temperature", Type: Gauge, Value: -1, Relative: true, SampleRate: 1},
+		},
+		{
+			name: "Timer with tags",
+			line: "latency:120|ms|#host:web1,region:eu",
+			want: &Sample{Name: "latency", Type: Timer, Value: 120, SampleRate: 1, Labels: models.Labels{"host": "web1", "region": "eu"}},
+		},
+		{
+			name:    "Set is not supported",
+			line:    "users:42|s",
+			wantErr: true,
+		},
+		{
+			name:    "Without type",
+			line:    "requests:1",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid value",
+			line:    "requests:abc|c",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid sample rate",
+			line:    "requests:1|c|@2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -10,5 +10,8 @@ type HTTPHandlers interface {
 	Update(w http.ResponseWriter, r *http.Request)
 	UpdateJSON(w http.ResponseWriter, r *http.Request)
 	Updates(w http.ResponseWriter, r *http.Request)
+	InfluxWrite(w http.ResponseWriter, r *http.Request)
+	Range(w http.ResponseWriter, r *http.Request)
+	Prometheus(w http.ResponseWriter, r *http.Request)
 	GetAll(w http.ResponseWriter, r *http.Request)
 }
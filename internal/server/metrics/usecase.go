@@ -2,13 +2,17 @@ package metrics
 
 import (
 	"context"
+	"time"
 
 	"go-metricscol/internal/models"
 )
 
 type UseCase interface {
-	Find(ctx context.Context, name string, mType models.MetricType) (*models.Metric, error)
+	Find(ctx context.Context, name string, mType models.MetricType, labels models.Labels) (*models.Metric, error)
 	Update(ctx context.Context, metric models.Metric) error
 	Updates(ctx context.Context, metrics []models.Metric) error
+	UpdatesPartial(ctx context.Context, metrics []models.Metric) error
 	GetAll(ctx context.Context) ([]models.Metric, error)
+	Select(ctx context.Context, matchers []models.LabelMatcher) ([]models.Metric, error)
+	Range(ctx context.Context, name string, mType models.MetricType, labels models.Labels, from time.Time, to time.Time) ([]models.Sample, error)
 }
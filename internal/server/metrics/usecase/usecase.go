@@ -2,10 +2,16 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"time"
 
 	"go-metricscol/internal/config"
+	"go-metricscol/internal/instrument"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/repository"
+	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/tenant"
 )
 
 type MetricsUC struct {
@@ -13,22 +19,194 @@ type MetricsUC struct {
 	config  *config.ServerConfig
 }
 
-func (m *MetricsUC) Find(ctx context.Context, name string, mType models.MetricType) (*models.Metric, error) {
-	return m.Storage.Get(ctx, name, mType)
+func (m *MetricsUC) Find(ctx context.Context, name string, mType models.MetricType, labels models.Labels) (*models.Metric, error) {
+	return m.Storage.Get(ctx, name, mType, labels)
 }
 
 func (m *MetricsUC) Update(ctx context.Context, metric models.Metric) error {
+	if instrument.IsReserved(metric.Name) {
+		return apierror.ReservedMetricName
+	}
+
+	if err := metric.Labels.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.admitSeries(ctx, []models.Metric{metric}); err != nil {
+		return err
+	}
+
 	return m.Storage.Update(ctx, metric)
 }
 
+// Updates stores all metrics of the batch. If any metric has reserved name or is invalid, nothing is stored
+// by repositories which support transactions.
 func (m *MetricsUC) Updates(ctx context.Context, metrics []models.Metric) error {
+	for _, metric := range metrics {
+		if instrument.IsReserved(metric.Name) {
+			return apierror.WithMetric(apierror.ReservedMetricName, metric.Name)
+		}
+	}
+
+	if err := m.admitSeries(ctx, metrics); err != nil {
+		return err
+	}
+
 	return m.Storage.Updates(ctx, metrics)
 }
 
+// UpdatesPartial stores valid metrics of the batch, metrics which are invalid or have reserved names are skipped
+// and reported in *apierror.BatchError with their indexes in metrics.
+// If series limits are exceeded, the whole batch is rejected.
+func (m *MetricsUC) UpdatesPartial(ctx context.Context, metrics []models.Metric) error {
+	var batchError apierror.BatchError
+
+	valid := make([]models.Metric, 0, len(metrics))
+	indexes := make([]int, 0, len(metrics))
+	for i, metric := range metrics {
+		if instrument.IsReserved(metric.Name) {
+			batchError.Add(i, metric.Name, apierror.ReservedMetricName)
+			continue
+		}
+
+		valid = append(valid, metric)
+		indexes = append(indexes, i)
+	}
+
+	if len(valid) == 0 && len(metrics) != 0 {
+		return batchError.Err()
+	}
+
+	if err := m.admitSeries(ctx, valid); err != nil {
+		return err
+	}
+
+	err := m.Storage.UpdatesPartial(ctx, valid)
+
+	var storageError *apierror.BatchError
+	if errors.As(err, &storageError) {
+		for _, item := range storageError.Items {
+			batchError.Add(indexes[item.Index], item.Name, item.Err)
+		}
+		sort.Slice(batchError.Items, func(i, j int) bool {
+			return batchError.Items[i].Index < batchError.Items[j].Index
+		})
+	} else if err != nil {
+		return err
+	}
+
+	return batchError.Err()
+}
+
+// admitSeries checks that new series created by metrics don't exceed series quota of the tenant,
+// series limit of the server and new series rate limit. Rejected writes are counted in instrument.RejectedWrites.
+// Concurrent requests may exceed series limits by their new series.
+func (m *MetricsUC) admitSeries(ctx context.Context, metrics []models.Metric) error {
+	if m.config == nil {
+		return nil
+	}
+
+	quota := m.config.Quota(tenant.FromContext(ctx))
+	if quota.MaxSeries <= 0 && m.config.MaxSeries <= 0 && m.config.MaxNewSeriesPerMinute <= 0 {
+		return nil
+	}
+
+	newSeries, err := m.countNewSeries(ctx, metrics)
+	if err != nil || newSeries == 0 {
+		return err
+	}
+
+	if quota.MaxSeries > 0 {
+		count, err := m.Storage.CountSeries(ctx)
+		if err != nil {
+			return err
+		}
+
+		if count+newSeries > quota.MaxSeries {
+			m.reject(config.RejectedTenantSeriesQuota)
+			return apierror.TenantSeriesQuotaExceeded
+		}
+	}
+
+	if m.config.MaxSeries > 0 {
+		count, err := m.Storage.CountAllSeries(ctx)
+		if err != nil {
+			return err
+		}
+
+		if count+newSeries > m.config.MaxSeries {
+			m.reject(config.RejectedMaxSeries)
+			return apierror.SeriesLimitExceeded
+		}
+	}
+
+	if !m.config.Admission().AllowNew(newSeries, m.config.MaxNewSeriesPerMinute, time.Now()) {
+		m.reject(config.RejectedNewSeriesRate)
+		return apierror.NewSeriesRateLimited
+	}
+
+	return nil
+}
+
+func (m *MetricsUC) reject(reason string) {
+	m.config.Instruments().Inc(instrument.RejectedWrites, models.Labels{"reason": reason})
+}
+
+// countNewSeries returns number of distinct series of metrics which are not stored yet.
+func (m *MetricsUC) countNewSeries(ctx context.Context, metrics []models.Metric) (int, error) {
+	newSeries := make(map[string]struct{})
+	for _, metric := range metrics {
+		key := metric.Name + string(metric.MType) + metric.Labels.String()
+		if _, ok := newSeries[key]; ok {
+			continue
+		}
+
+		_, err := m.Storage.Get(ctx, metric.Name, metric.MType, metric.Labels)
+		if errors.Is(err, apierror.NotFound) {
+			newSeries[key] = struct{}{}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(newSeries), nil
+}
+
 func (m *MetricsUC) GetAll(ctx context.Context) ([]models.Metric, error) {
 	return m.Storage.GetAll(ctx)
 }
 
+// Select returns all metrics which labels satisfy every matcher.
+func (m *MetricsUC) Select(ctx context.Context, matchers []models.LabelMatcher) ([]models.Metric, error) {
+	all, err := m.Storage.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Metric, 0, len(all))
+	for _, metric := range all {
+		if models.MatchLabels(metric.Labels, matchers) {
+			result = append(result, metric)
+		}
+	}
+
+	return result, nil
+}
+
+// Range returns history of the metric series between from and to inclusive.
+// If to is zero, current time is used.
+func (m *MetricsUC) Range(ctx context.Context, name string, mType models.MetricType, labels models.Labels, from time.Time, to time.Time) ([]models.Sample, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if to.Before(from) {
+		return nil, apierror.InvalidRange
+	}
+
+	return m.Storage.GetRange(ctx, name, mType, labels, from, to)
+}
+
 func NewMetricsUC(storage repository.Repository, config *config.ServerConfig) *MetricsUC {
 	return &MetricsUC{Storage: storage, config: config}
 }
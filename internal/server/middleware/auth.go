@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/server/apierror"
+)
+
+// HTTPAuthHandler is a middleware which authenticates agent with bearer token from Authorization header
+// and stores it in request context, see auth.FromContext.
+// If token is missing, unknown or revoked, apierror.Unauthorized is returned.
+func (mw *Manager) HTTPAuthHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mw.cfg.Tokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		agent, err := authenticate(r.Context(), mw.cfg.Tokens, r.Header.Get("Authorization"))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apierror.WriteHTTP(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), agent)))
+	})
+}
+
+// GrpcAuthHandler is an interceptor which authenticates agent with bearer token from authorization metadata
+// and stores it in context, see auth.FromContext.
+func (mw *Manager) GrpcAuthHandler(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if mw.cfg.Tokens == nil {
+		return handler(ctx, req)
+	}
+
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	agent, err := authenticate(ctx, mw.cfg.Tokens, header)
+	if err != nil {
+		return nil, apierror.GRPCStatus(err)
+	}
+
+	return handler(auth.NewContext(ctx, agent), req)
+}
+
+func authenticate(ctx context.Context, tokens auth.TokenStore, header string) (auth.Agent, error) {
+	token, ok := auth.ParseBearer(header)
+	if !ok {
+		return auth.Agent{}, apierror.Unauthorized
+	}
+
+	agent, err := tokens.LookupToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnknownToken) {
+			return auth.Agent{}, apierror.Unauthorized
+		}
+
+		log.Printf("Couldn't look up token with error: %s", err)
+		return auth.Agent{}, apierror.NewAPIError(http.StatusInternalServerError, "token_lookup_failed", "couldn't look up token")
+	}
+
+	return agent, nil
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/config"
+)
+
+type fakeTokenStore map[string]auth.Agent
+
+func (s fakeTokenStore) LookupToken(_ context.Context, token string) (auth.Agent, error) {
+	agent, ok := s[token]
+	if !ok {
+		return auth.Agent{}, auth.ErrUnknownToken
+	}
+
+	return agent, nil
+}
+
+func Test_httpAuthHandler(t *testing.T) {
+	tokens := fakeTokenStore{"token-1": {Name: "agent-1"}}
+
+	tests := []struct {
+		name       string
+		tokens     auth.TokenStore
+		header     string
+		statusCode int
+		agent      string
+	}{
+		{
+			name:       "Authentication disabled",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Valid token",
+			tokens:     tokens,
+			header:     "Bearer token-1",
+			statusCode: http.StatusOK,
+			agent:      "agent-1",
+		},
+		{
+			name:       "Unknown token",
+			tokens:     tokens,
+			header:     "Bearer token-2",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "No token",
+			tokens:     tokens,
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			require.NoError(t, err)
+			if len(tt.header) != 0 {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			var agent auth.Agent
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				agent, _ = auth.FromContext(r.Context())
+			})
+
+			rr := httptest.NewRecorder()
+			mw := NewManager(nil, nil, &config.ServerConfig{Tokens: tt.tokens}, nil)
+			mw.HTTPAuthHandler(handler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, tt.agent, agent.Name)
+		})
+	}
+}
+
+func Test_grpcAuthHandler(t *testing.T) {
+	mw := NewManager(nil, nil, &config.ServerConfig{Tokens: fakeTokenStore{"token-1": {Name: "agent-1"}}}, nil)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		agent, _ := auth.FromContext(ctx)
+		return agent, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token-1"))
+	resp, err := mw.GrpcAuthHandler(ctx, nil, nil, handler)
+	require.NoError(t, err)
+	assert.Equal(t, auth.Agent{Name: "agent-1"}, resp)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token-2"))
+	_, err = mw.GrpcAuthHandler(ctx, nil, nil, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = mw.GrpcAuthHandler(context.Background(), nil, nil, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
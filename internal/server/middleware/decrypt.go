@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"go-metricscol/internal/envelope"
+	"go-metricscol/internal/instrument"
+	"go-metricscol/internal/server/apierror"
+)
+
+// DecryptHandler is a middleware which decrypts request body encrypted with envelope.Encrypt.
+// If crypto key isn't set in config, request is passed as is. If body couldn't be decrypted, 400 status code is returned.
+func (mw *Manager) DecryptHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mw.cfg.CryptoKey != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				apierror.WriteHTTP(w, err)
+				return
+			}
+
+			decrypted, err := envelope.Decrypt(mw.cfg.CryptoKey, body)
+			if err != nil {
+				mw.cfg.Instruments().Inc(instrument.DecryptFailures, nil)
+				apierror.WriteHTTP(w, apierror.DecryptionFailed)
+				log.Printf("Couldn't decrypt body with error: %s", err)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewBuffer(decrypted))
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// encryptedRequest is a grpc request which may contain serialized request encrypted with envelope.Encrypt.
+type encryptedRequest interface {
+	protobuf.Message
+	GetEncrypted() []byte
+}
+
+// DecryptGrpcHandler is an interceptor which replaces update requests with requests decrypted from their encrypted field.
+// If crypto key isn't set in config, request is passed as is.
+func (mw *Manager) DecryptGrpcHandler(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	request, ok := req.(encryptedRequest)
+	if !ok || mw.cfg.CryptoKey == nil {
+		return handler(ctx, req)
+	}
+
+	if len(request.GetEncrypted()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "request isn't encrypted")
+	}
+
+	payload, err := envelope.Decrypt(mw.cfg.CryptoKey, request.GetEncrypted())
+	if err != nil {
+		mw.cfg.Instruments().Inc(instrument.DecryptFailures, nil)
+		log.Printf("Couldn't decrypt request with error: %s", err)
+		return nil, apierror.GRPCStatus(apierror.DecryptionFailed)
+	}
+
+	decrypted := request.ProtoReflect().New().Interface()
+	if err := protobuf.Unmarshal(payload, decrypted); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "couldn't unmarshal decrypted request")
+	}
+
+	return handler(ctx, decrypted)
+}
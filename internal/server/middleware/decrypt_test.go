@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/envelope"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/proto"
+	"go-metricscol/internal/utils"
+)
+
+func Test_decryptHandler(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	text := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1},`), 100)
+	encrypted, err := envelope.Encrypt(&privateKey.PublicKey, text)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		cryptoKey  *rsa.PrivateKey
+		body       []byte
+		statusCode int
+		response   []byte
+	}{
+		{
+			name:       "Encryption disabled",
+			body:       text,
+			statusCode: http.StatusOK,
+			response:   text,
+		},
+		{
+			name:       "Encrypted body",
+			cryptoKey:  privateKey,
+			body:       encrypted,
+			statusCode: http.StatusOK,
+			response:   text,
+		},
+		{
+			name:       "Not encrypted body",
+			cryptoKey:  privateKey,
+			body:       text,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "", bytes.NewReader(tt.body))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			mw := NewManager(nil, nil, &config.ServerConfig{CryptoKey: tt.cryptoKey}, nil)
+			mw.DecryptHandler(testHandler).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.statusCode, rr.Code)
+			if tt.response != nil {
+				assert.Equal(t, tt.response, rr.Body.Bytes())
+			}
+		})
+	}
+}
+
+func Test_decryptGrpcHandler(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	metrics := []*proto.Metric{
+		proto.NewMetric(models.Metric{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(1.5)}, ""),
+		proto.NewMetric(models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(3))}, ""),
+	}
+
+	payload, err := protobuf.Marshal(&proto.UpdatesRequest{Metric: metrics})
+	require.NoError(t, err)
+	encrypted, err := envelope.Encrypt(&privateKey.PublicKey, payload)
+	require.NoError(t, err)
+
+	mw := NewManager(nil, nil, &config.ServerConfig{CryptoKey: privateKey}, nil)
+	handler := func(_ context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+
+	resp, err := mw.DecryptGrpcHandler(context.Background(), &proto.UpdatesRequest{Encrypted: encrypted}, nil, handler)
+	require.NoError(t, err)
+	assert.True(t, protobuf.Equal(&proto.UpdatesRequest{Metric: metrics}, resp.(*proto.UpdatesRequest)))
+
+	_, err = mw.DecryptGrpcHandler(context.Background(), &proto.UpdatesRequest{Metric: metrics}, nil, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = mw.DecryptGrpcHandler(context.Background(), &proto.UpdateRequest{Encrypted: []byte("not encrypted")}, nil, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	listRequest := &proto.ListRequest{}
+	resp, err = mw.DecryptGrpcHandler(context.Background(), listRequest, nil, handler)
+	require.NoError(t, err)
+	assert.Same(t, listRequest, resp)
+}
@@ -6,8 +6,6 @@ import (
 	"net/http"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 
 	"go-metricscol/internal/config"
 	"go-metricscol/internal/repository"
@@ -29,18 +27,37 @@ func (mw *Manager) DiskSaverGrpcMiddleware(ctx context.Context, req interface{},
 	resp, err := handler(ctx, req)
 
 	if err := diskSaverMiddleware(mw.cfg, mw.repo); err != nil {
-		// TODO: implement own code errors system
-		return nil, status.Errorf(codes.Internal, err.Message)
+		return nil, apierror.GRPCStatus(err)
 	}
 
 	return resp, err
 }
 
+// DiskSaverStatsDMiddleware saves metrics to disk after every flush of StatsD metrics.
+func (mw *Manager) DiskSaverStatsDMiddleware(next func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := next(ctx); err != nil {
+			return err
+		}
+
+		if err := diskSaverMiddleware(mw.cfg, mw.repo); err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// diskSaverMiddleware saves metrics to disk after every update if store interval is zero.
+// Duration of saving is recorded in instrument.DiskSaveDuration with "sync" mode.
 func diskSaverMiddleware(cfg *config.ServerConfig, repository repository.Repository) *apierror.APIError {
 	saveToDisk := cfg.StoreInterval == 0 && len(cfg.StoreFile) != 0 && len(cfg.DatabaseDSN) == 0
 	if saveToDisk {
-		if err := repository.SaveToDisk(cfg.StoreFile); err != nil {
-			return apierror.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("Couldn't save metrics to disk with error: %s", err))
+		err := cfg.Instruments().TimeDiskSave("sync", func() error {
+			return repository.SaveToDisk(cfg.StoreFile)
+		})
+		if err != nil {
+			return apierror.NewAPIError(http.StatusInternalServerError, "disk_save_failed", fmt.Sprintf("Couldn't save metrics to disk with error: %s", err))
 		}
 	}
 
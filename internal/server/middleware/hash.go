@@ -3,43 +3,55 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
 	"encoding/json"
 	"io"
 	"net/http"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/instrument"
 	"go-metricscol/internal/models"
 	"go-metricscol/internal/proto"
 	"go-metricscol/internal/server/apierror"
 )
 
 // ValidateHashHandler is a middleware which gets models.Metric from request, calculates hash and compares it with given.
-// If the hashes do not match, http.Error is called with code 400.
+// If request has models.BodyHashHeader, hash of the whole body is validated too.
+// If the hashes do not match or signed metric is replayed, error response with code 400 is written.
 func (mw *Manager) ValidateHashHandler(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		hashKey := mw.cfg.HashKey
 		if len(hashKey) != 0 {
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
-				http.Error(w, "couldn't read body", http.StatusInternalServerError)
+				apierror.WriteHTTP(w, err)
 				return
 			}
 
 			var metric models.Metric
 			err = json.Unmarshal(body, &metric)
 			if err != nil {
-				http.Error(w, "couldn't parse json", http.StatusInternalServerError)
+				apierror.WriteHTTP(w, apierror.JSONError(err))
 				return
 			}
 
-			if err := validateHashHandler(hashKey, metric); err != nil {
+			if err := validateBodyHash(hashKey, body, r.Header.Get(models.BodyHashHeader)); err != nil {
+				mw.hashValidationFailed(err)
 				apierror.WriteHTTP(w, err)
 				return
 			}
 
+			if err := validateHashHandler(mw.cfg, metric, time.Now()); err != nil {
+				mw.hashValidationFailed(err)
+				apierror.WriteHTTP(w, apierror.WithMetric(err, metric.Name))
+				return
+			}
+
 			r.Body = io.NopCloser(bytes.NewBuffer(body))
 		}
 
@@ -53,48 +65,97 @@ func (mw *Manager) ValidateHashGrpcHandler(ctx context.Context, req interface{},
 		return handler(ctx, req)
 	}
 
-	hashKey := mw.cfg.HashKey
+	if len(mw.cfg.HashKey) == 0 {
+		return handler(ctx, req)
+	}
 
 	metric, err := proto.ParseMetricFromRequest(updateRequest.Metric)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "couldn't parse metric")
 	}
 
-	if err := validateHashHandler(hashKey, *metric); err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Message)
+	if err := validateHashHandler(mw.cfg, *metric, time.Now()); err != nil {
+		mw.hashValidationFailed(err)
+		return nil, apierror.GRPCStatus(err)
 	}
 
 	return handler(ctx, req)
 }
 
-func validateHashHandler(hashKey string, metric models.Metric) *apierror.APIError {
-	if metric.HashValue(hashKey) != metric.Hash {
-		return apierror.NewAPIError(http.StatusBadRequest, "hash mismatch")
+// hashValidationFailed counts request rejected by hash or replay validation.
+func (mw *Manager) hashValidationFailed(err *apierror.APIError) {
+	mw.cfg.Instruments().Inc(instrument.HashValidationFailures, models.Labels{"reason": err.Code})
+}
+
+func validateHashHandler(cfg *config.ServerConfig, metric models.Metric, now time.Time) *apierror.APIError {
+	if !hmac.Equal([]byte(metric.HashValue(cfg.HashKey)), []byte(metric.Hash)) {
+		return apierror.NewAPIError(http.StatusBadRequest, "hash_mismatch", "hash mismatch")
+	}
+
+	return validateReplay(cfg, metric, now)
+}
+
+// validateReplay checks that signed metric is inside replay window and its nonce wasn't seen before.
+// It must be called only after hash is validated, so nonce cache is not filled with unsigned nonces.
+// Nonces aren't bound to ClientIdentity: hash key is shared by all agents, so signature doesn't prove
+// which client produced the metric, and nonce seen from any client must reject the metric from every other one.
+// Otherwise a client with another certificate could replay captured metrics.
+func validateReplay(cfg *config.ServerConfig, metric models.Metric, now time.Time) *apierror.APIError {
+	if cfg.ReplayWindow == 0 {
+		return nil
+	}
+
+	if len(metric.Nonce) == 0 {
+		return &apierror.MissingNonce
+	}
+
+	signedAt := time.Unix(metric.Timestamp, 0)
+	if signedAt.Before(now.Add(-cfg.ReplayWindow)) || signedAt.After(now.Add(cfg.ReplayWindow)) {
+		return &apierror.OutsideReplayWindow
+	}
+
+	if !cfg.NonceCache().Add(metric.Nonce) {
+		return &apierror.ReplayedRequest
 	}
 
 	return nil
 }
 
 // ValidateHashesHandler is a middleware which gets []models.Metric from request, calculates hashes and compares them with given.
-// If at least one of the hashes do not match, http.Error is called with code 400.
+// If request has models.BodyHashHeader, the whole batch is validated with it and hashes of separate metrics are not required,
+// otherwise every metric is validated with its own hash for compatibility with older agents.
+// If at least one of the hashes do not match or signed metric is replayed, error response with code 400 is written.
 func (mw *Manager) ValidateHashesHandler(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		hashKey := mw.cfg.HashKey
 		if len(hashKey) != 0 {
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
-				http.Error(w, "couldn't read body", http.StatusInternalServerError)
+				apierror.WriteHTTP(w, err)
 				return
 			}
 
 			var metrics []models.Metric
 			err = json.Unmarshal(body, &metrics)
 			if err != nil {
-				http.Error(w, "couldn't parse json", http.StatusInternalServerError)
+				apierror.WriteHTTP(w, apierror.JSONError(err))
 				return
 			}
 
-			if err := validateHashesHandler(hashKey, metrics); err != nil {
+			if bodyHash := r.Header.Get(models.BodyHashHeader); len(bodyHash) != 0 {
+				if err := validateBodyHash(hashKey, body, bodyHash); err != nil {
+					mw.hashValidationFailed(err)
+					apierror.WriteHTTP(w, err)
+					return
+				}
+
+				if err := validateReplays(mw.cfg, metrics, time.Now()); err != nil {
+					mw.hashValidationFailed(err)
+					apierror.WriteHTTP(w, err)
+					return
+				}
+			} else if err := validateHashesHandler(mw.cfg, metrics, time.Now()); err != nil {
+				mw.hashValidationFailed(err)
 				apierror.WriteHTTP(w, err)
 				return
 			}
@@ -112,7 +173,10 @@ func (mw *Manager) ValidateHashesGrpcHandler(ctx context.Context, req interface{
 		return handler(ctx, req)
 	}
 
-	hashKey := mw.cfg.HashKey
+	if len(mw.cfg.HashKey) == 0 {
+		return handler(ctx, req)
+	}
+
 	var metrics []models.Metric
 
 	for _, metric := range updateRequest.Metric {
@@ -123,19 +187,43 @@ func (mw *Manager) ValidateHashesGrpcHandler(ctx context.Context, req interface{
 		metrics = append(metrics, *m)
 	}
 
-	if err := validateHashesHandler(hashKey, metrics); err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Message)
+	if err := validateHashesHandler(mw.cfg, metrics, time.Now()); err != nil {
+		mw.hashValidationFailed(err)
+		return nil, apierror.GRPCStatus(err)
 	}
 
 	return handler(ctx, req)
 }
 
-func validateHashesHandler(hashKey string, metrics []models.Metric) *apierror.APIError {
+func validateHashesHandler(cfg *config.ServerConfig, metrics []models.Metric, now time.Time) *apierror.APIError {
 	for _, metric := range metrics {
-		if metric.HashValue(hashKey) != metric.Hash {
-			return apierror.NewAPIError(http.StatusBadRequest, "hash mismatch")
+		if !hmac.Equal([]byte(metric.HashValue(cfg.HashKey)), []byte(metric.Hash)) {
+			return apierror.NewAPIError(http.StatusBadRequest, "hash_mismatch", "hash mismatch")
 		}
 	}
 
+	return validateReplays(cfg, metrics, now)
+}
+
+func validateReplays(cfg *config.ServerConfig, metrics []models.Metric, now time.Time) *apierror.APIError {
+	for _, metric := range metrics {
+		if err := validateReplay(cfg, metric, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateBodyHash compares HMAC of the whole body with the value of models.BodyHashHeader, if it is set.
+func validateBodyHash(hashKey string, body []byte, bodyHash string) *apierror.APIError {
+	if len(bodyHash) == 0 {
+		return nil
+	}
+
+	if !hmac.Equal([]byte(models.HashBody(hashKey, body)), []byte(bodyHash)) {
+		return &apierror.BodyHashMismatch
+	}
+
 	return nil
 }
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/utils"
+)
+
+func signedMetric(t *testing.T, key string, signedAt time.Time) models.Metric {
+	metric := models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(1))}
+	require.NoError(t, metric.Sign(key, signedAt))
+
+	return metric
+}
+
+func TestValidateHashesHandler_Replay(t *testing.T) {
+	const key = "secret"
+	now := time.Now()
+
+	replayed := signedMetric(t, key, now)
+	unsigned := models.Metric{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(1))}
+	unsigned.Hash = unsigned.HashValue(key)
+	tampered := signedMetric(t, key, now)
+	tampered.Timestamp++
+
+	cfg := &config.ServerConfig{HashKey: key, ReplayWindow: time.Minute, NonceCacheSize: 10}
+	mw := NewManager(nil, nil, cfg, nil)
+
+	tests := []struct {
+		name       string
+		metrics    []models.Metric
+		statusCode int
+	}{
+		{
+			name:       "Signed metrics",
+			metrics:    []models.Metric{replayed, signedMetric(t, key, now.Add(-30*time.Second))},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Replayed metric",
+			metrics:    []models.Metric{signedMetric(t, key, now), replayed},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Metric signed before replay window",
+			metrics:    []models.Metric{signedMetric(t, key, now.Add(-2*time.Minute))},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Metric signed after replay window",
+			metrics:    []models.Metric{signedMetric(t, key, now.Add(2*time.Minute))},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Metric without nonce",
+			metrics:    []models.Metric{unsigned},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Tampered timestamp",
+			metrics:    []models.Metric{tampered},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.metrics)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "", bytes.NewReader(body))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			mw.ValidateHashesHandler(testHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestValidateHashHandler_ReplayDisabled(t *testing.T) {
+	const key = "secret"
+
+	metric := models.Metric{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(1.5)}
+	metric.Hash = metric.HashValue(key)
+
+	mw := NewManager(nil, nil, &config.ServerConfig{HashKey: key}, nil)
+	for i := 0; i < 2; i++ {
+		body, err := json.Marshal(metric)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewReader(body))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		mw.ValidateHashHandler(testHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+}
+
+func TestValidateHashHandler_ReplayByAnotherClient(t *testing.T) {
+	const key = "secret"
+
+	cfg := &config.ServerConfig{HashKey: key, ReplayWindow: time.Minute, NonceCacheSize: 10}
+	mw := NewManager(nil, nil, cfg, nil)
+
+	body, err := json.Marshal(signedMetric(t, key, time.Now()))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		identity   ClientIdentity
+		statusCode int
+	}{
+		{
+			name:       "Sent by client",
+			identity:   ClientIdentity{Name: "agent-1"},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Replayed by another client",
+			identity:   ClientIdentity{Name: "agent-2"},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "", bytes.NewReader(body))
+			require.NoError(t, err)
+			req = req.WithContext(context.WithValue(req.Context(), clientIdentityKey{}, tt.identity))
+
+			rr := httptest.NewRecorder()
+			mw.ValidateHashHandler(testHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestValidateHashesHandler_BodyHash(t *testing.T) {
+	const key = "secret"
+
+	metrics := []models.Metric{
+		{Name: "Alloc", MType: models.Gauge, Value: utils.Ptr(1.5)},
+		{Name: "PollCount", MType: models.Counter, Delta: utils.Ptr(int64(1))},
+	}
+	body, err := json.Marshal(metrics)
+	require.NoError(t, err)
+
+	reordered, err := json.Marshal([]models.Metric{metrics[1], metrics[0]})
+	require.NoError(t, err)
+	dropped, err := json.Marshal(metrics[:1])
+	require.NoError(t, err)
+
+	hashed := make([]models.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		metric.Hash = metric.HashValue(key)
+		hashed = append(hashed, metric)
+	}
+	hashedBody, err := json.Marshal(hashed)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       []byte
+		bodyHash   string
+		statusCode int
+	}{
+		{
+			name:       "Signed batch",
+			body:       body,
+			bodyHash:   models.HashBody(key, body),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Reordered batch",
+			body:       reordered,
+			bodyHash:   models.HashBody(key, body),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Metric dropped from batch",
+			body:       dropped,
+			bodyHash:   models.HashBody(key, body),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Batch signed with other key",
+			body:       body,
+			bodyHash:   models.HashBody("other", body),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Metrics signed separately",
+			body:       hashedBody,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Neither batch nor metrics signed",
+			body:       body,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "", bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			if len(tt.bodyHash) != 0 {
+				req.Header.Set(models.BodyHashHeader, tt.bodyHash)
+			}
+
+			rr := httptest.NewRecorder()
+			mw := NewManager(nil, nil, &config.ServerConfig{HashKey: key}, nil)
+			mw.ValidateHashesHandler(testHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
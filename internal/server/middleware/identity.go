@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIdentity is identity of the client verified with its TLS certificate.
+// It's used by trusted subnet checks only, see validateReplay for why nonces are not bound to it.
+type ClientIdentity struct {
+	// Name is common name of the client certificate.
+	Name string
+	// IPs are IP addresses of the client certificate or the address of the connection if certificate has none.
+	IPs []net.IP
+}
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFromContext returns identity of the client verified by GrpcClientIdentityHandler or HTTPClientIdentityHandler.
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	identity, ok := ctx.Value(clientIdentityKey{}).(ClientIdentity)
+	return identity, ok
+}
+
+// GrpcClientIdentityHandler is an interceptor which stores identity of the client in context,
+// if the client presented verified certificate (mutual TLS). Following handlers use it in place of self-reported X-Real-IP.
+func (mw *Manager) GrpcClientIdentityHandler(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	if identity, ok := clientIdentity(tlsInfo.State, p.Addr); ok {
+		ctx = context.WithValue(ctx, clientIdentityKey{}, identity)
+	}
+
+	return handler(ctx, req)
+}
+
+// HTTPClientIdentityHandler is a middleware which stores identity of the client in request context,
+// if the client presented verified certificate (mutual TLS). Following handlers use it in place of self-reported X-Real-IP.
+func (mw *Manager) HTTPClientIdentityHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var addr net.Addr
+		if tcpAddr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+			addr = tcpAddr
+		}
+
+		if identity, ok := clientIdentity(*r.TLS, addr); ok {
+			r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, identity))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIdentity returns identity of the client if its certificate was verified.
+func clientIdentity(state tls.ConnectionState, addr net.Addr) (ClientIdentity, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ClientIdentity{}, false
+	}
+
+	certificate := state.VerifiedChains[0][0]
+	identity := ClientIdentity{
+		Name: certificate.Subject.CommonName,
+		IPs:  certificate.IPAddresses,
+	}
+
+	if len(identity.IPs) == 0 {
+		if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+			identity.IPs = []net.IP{tcpAddr.IP}
+		}
+	}
+
+	return identity, true
+}
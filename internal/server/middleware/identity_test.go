@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/config"
+)
+
+func peerContext(certificateIPs []net.IP, addr string) context.Context {
+	certificate := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "agent-1"},
+		IPAddresses: certificateIPs,
+	}
+
+	p := &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 12345},
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}},
+		},
+	}
+
+	// Self-reported address is in trusted subnet, it mustn't be used if client is verified.
+	md := metadata.Pairs("X-Real-IP", "192.168.0.10")
+
+	return metadata.NewIncomingContext(peer.NewContext(context.Background(), p), md)
+}
+
+func Test_grpcClientIdentityHandler(t *testing.T) {
+	mw := NewManager(nil, nil, &config.ServerConfig{TrustedSubnet: "192.168.0.0/24"}, nil)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		identity ClientIdentity
+		code     codes.Code
+	}{
+		{
+			name:     "Certificate IP in trusted subnet",
+			ctx:      peerContext([]net.IP{net.ParseIP("192.168.0.2")}, "10.0.0.1"),
+			identity: ClientIdentity{Name: "agent-1", IPs: []net.IP{net.ParseIP("192.168.0.2")}},
+			code:     codes.OK,
+		},
+		{
+			name:     "Certificate IP not in trusted subnet",
+			ctx:      peerContext([]net.IP{net.ParseIP("10.0.0.1")}, "192.168.0.2"),
+			identity: ClientIdentity{Name: "agent-1", IPs: []net.IP{net.ParseIP("10.0.0.1")}},
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Connection address is used if certificate has no IP",
+			ctx:      peerContext(nil, "10.0.0.1"),
+			identity: ClientIdentity{Name: "agent-1", IPs: []net.IP{net.ParseIP("10.0.0.1")}},
+			code:     codes.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var identity ClientIdentity
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				identity, _ = ClientIdentityFromContext(ctx)
+				return mw.GrpcTrustedSubnetHandler(ctx, req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return req, nil
+				})
+			}
+
+			_, err := mw.GrpcClientIdentityHandler(tt.ctx, nil, nil, handler)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.identity.Name, identity.Name)
+			require.Len(t, identity.IPs, len(tt.identity.IPs))
+			for i, ip := range tt.identity.IPs {
+				assert.True(t, ip.Equal(identity.IPs[i]))
+			}
+		})
+	}
+}
+
+func Test_grpcClientIdentityHandlerWithoutTLS(t *testing.T) {
+	mw := NewManager(nil, nil, &config.ServerConfig{}, nil)
+
+	_, err := mw.GrpcClientIdentityHandler(context.Background(), nil, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, ok := ClientIdentityFromContext(ctx)
+		assert.False(t, ok)
+		return req, nil
+	})
+	require.NoError(t, err)
+}
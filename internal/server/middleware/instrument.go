@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	chiMiddleware "github.com/go-chi/chi/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/instrument"
+	"go-metricscol/internal/models"
+)
+
+// HTTPInstrumentHandler is a middleware which counts requests by route, method and status code and measures their latency.
+// Route is a pattern of chi route, so metrics don't grow with the number of metric names in request paths.
+func (mw *Manager) HTTPInstrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unknown"
+		if routeContext := chi.RouteContext(r.Context()); routeContext != nil && len(routeContext.RoutePattern()) != 0 {
+			route = routeContext.RoutePattern()
+		}
+
+		statusCode := ww.Status()
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+
+		registry := mw.cfg.Instruments()
+		registry.Inc(instrument.HTTPRequests, models.Labels{"route": route, "method": r.Method, "code": strconv.Itoa(statusCode)})
+		registry.ObserveSince(instrument.HTTPRequestDuration, models.Labels{"route": route, "method": r.Method}, start)
+	})
+}
+
+// GrpcInstrumentHandler is an interceptor which counts calls by method and status code and measures their latency.
+func (mw *Manager) GrpcInstrumentHandler(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	registry := mw.cfg.Instruments()
+	registry.Inc(instrument.GrpcRequests, models.Labels{"method": info.FullMethod, "code": status.Code(err).String()})
+	registry.ObserveSince(instrument.GrpcRequestDuration, models.Labels{"method": info.FullMethod}, start)
+
+	return resp, err
+}
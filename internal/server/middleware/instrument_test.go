@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/instrument"
+	"go-metricscol/internal/models"
+)
+
+func TestHTTPInstrumentHandler(t *testing.T) {
+	cfg := &config.ServerConfig{}
+	mw := NewManager(nil, nil, cfg, nil)
+
+	r := chi.NewRouter()
+	r.Use(mw.HTTPInstrumentHandler)
+	r.Get("/value/{type}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, name := range []string{"Alloc", "Frees"} {
+		req, err := http.NewRequest(http.MethodGet, "/value/gauge/"+name, nil)
+		require.NoError(t, err)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	metrics := cfg.Instruments().Metrics()
+	require.Len(t, metrics, 2)
+
+	assert.Equal(t, instrument.HTTPRequestDuration, metrics[0].Name)
+	assert.Equal(t, models.Labels{"method": http.MethodGet, "route": "/value/{type}/{name}"}, metrics[0].Labels)
+
+	assert.Equal(t, instrument.HTTPRequests, metrics[1].Name)
+	assert.Equal(t, models.Labels{"code": "404", "method": http.MethodGet, "route": "/value/{type}/{name}"}, metrics[1].Labels)
+	assert.Equal(t, int64(2), *metrics[1].Delta)
+}
+
+func TestGrpcInstrumentHandler(t *testing.T) {
+	cfg := &config.ServerConfig{}
+	mw := NewManager(nil, nil, cfg, nil)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.InvalidArgument, "invalid metric")
+	}
+
+	_, err := mw.GrpcInstrumentHandler(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/Metrics/UpdateMetric"}, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	metrics := cfg.Instruments().Metrics()
+	require.Len(t, metrics, 2)
+
+	assert.Equal(t, instrument.GrpcRequestDuration, metrics[0].Name)
+	assert.Equal(t, instrument.GrpcRequests, metrics[1].Name)
+	assert.Equal(t, models.Labels{"code": codes.InvalidArgument.String(), "method": "/Metrics/UpdateMetric"}, metrics[1].Labels)
+}
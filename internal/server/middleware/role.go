@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/server/apierror"
+)
+
+// RequireRole is a middleware which allows request only if authenticated agent has the required role.
+// Otherwise apierror.Forbidden is returned. Roles aren't checked if authentication is disabled.
+func (mw *Manager) RequireRole(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mw.allowed(r.Context(), role) {
+			apierror.WriteHTTP(w, apierror.Forbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// GrpcRoleHandler returns an interceptor which allows call only if authenticated agent has the role
+// required by roles for its full method name. Methods missing in roles require auth.Admin.
+func (mw *Manager) GrpcRoleHandler(roles map[string]auth.Role) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		role, ok := roles[info.FullMethod]
+		if !ok {
+			role = auth.Admin
+		}
+
+		if !mw.allowed(ctx, role) {
+			return nil, apierror.GRPCStatus(apierror.Forbidden)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (mw *Manager) allowed(ctx context.Context, role auth.Role) bool {
+	if mw.cfg.Tokens == nil {
+		return true
+	}
+
+	agent, ok := auth.FromContext(ctx)
+	return ok && agent.Role.Allows(role)
+}
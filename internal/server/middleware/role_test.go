@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/config"
+)
+
+func TestRequireRole(t *testing.T) {
+	tokens := fakeTokenStore{}
+
+	tests := []struct {
+		name       string
+		tokens     auth.TokenStore
+		agent      *auth.Agent
+		statusCode int
+	}{
+		{
+			name:       "Authentication disabled",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Role is enough",
+			tokens:     tokens,
+			agent:      &auth.Agent{Name: "agent-1", Role: auth.Admin},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Role is not enough",
+			tokens:     tokens,
+			agent:      &auth.Agent{Name: "agent-1", Role: auth.Reader},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "No agent",
+			tokens:     tokens,
+			statusCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/update/", nil)
+			require.NoError(t, err)
+			if tt.agent != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), *tt.agent))
+			}
+
+			rr := httptest.NewRecorder()
+			mw := NewManager(nil, nil, &config.ServerConfig{Tokens: tt.tokens}, nil)
+			mw.RequireRole(auth.Writer, func(w http.ResponseWriter, r *http.Request) {})(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestGrpcRoleHandler(t *testing.T) {
+	mw := NewManager(nil, nil, &config.ServerConfig{Tokens: fakeTokenStore{}}, nil)
+	interceptor := mw.GrpcRoleHandler(map[string]auth.Role{"/Metrics/Value": auth.Reader})
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		role   auth.Role
+		code   codes.Code
+	}{
+		{name: "Listed method", method: "/Metrics/Value", role: auth.Reader, code: codes.OK},
+		{name: "Unlisted method requires admin", method: "/Metrics/Delete", role: auth.Writer, code: codes.PermissionDenied},
+		{name: "Admin calls unlisted method", method: "/Metrics/Delete", role: auth.Admin, code: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := auth.NewContext(context.Background(), auth.Agent{Name: "agent-1", Role: tt.role})
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
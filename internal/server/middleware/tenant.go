@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/server/apierror"
+	"go-metricscol/internal/tenant"
+)
+
+// HTTPTenantHandler is a middleware which stores tenant of the request in context, see tenant.FromContext.
+// Tenant of authenticated agent is used if it has one, otherwise tenant is read from tenant.Header if config allows it.
+// Requests above the rate limit of the tenant are rejected with apierror.TenantRateLimited.
+func (mw *Manager) HTTPTenantHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := mw.resolveTenant(r.Context(), r.Header.Get(tenant.Header), time.Now())
+		if err != nil {
+			apierror.WriteHTTP(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), name)))
+	})
+}
+
+// GrpcTenantHandler is an interceptor which stores tenant of the call in context,
+// tenant is read from tenant.MetadataKey metadata if agent has no tenant and config allows it.
+func (mw *Manager) GrpcTenantHandler(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var requested string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(tenant.MetadataKey); len(values) > 0 {
+			requested = values[0]
+		}
+	}
+
+	name, err := mw.resolveTenant(ctx, requested, time.Now())
+	if err != nil {
+		return nil, apierror.GRPCStatus(err)
+	}
+
+	return handler(tenant.NewContext(ctx, name), req)
+}
+
+// resolveTenant returns tenant of the request and takes a token from its rate limiter.
+// Agent bound to a tenant can't request another one. Other requests may select tenant other than tenant.Default
+// only if config.ServerConfig.TenantFromHeader is enabled, otherwise anyone could use keyspace and quota of any tenant.
+func (mw *Manager) resolveTenant(ctx context.Context, requested string, now time.Time) (string, error) {
+	name := requested
+	if agent, ok := auth.FromContext(ctx); ok && len(agent.Tenant) != 0 {
+		if len(requested) != 0 && requested != agent.Tenant {
+			return "", apierror.Forbidden
+		}
+		name = agent.Tenant
+	} else if len(requested) != 0 && requested != tenant.Default && !mw.cfg.TenantFromHeader {
+		return "", apierror.Forbidden
+	}
+
+	if len(name) == 0 {
+		name = tenant.Default
+	}
+
+	if err := tenant.Validate(name); err != nil {
+		return "", apierror.InvalidTenant
+	}
+
+	if !mw.cfg.TenantLimiter().Allow(name, mw.cfg.Quota(name).RateLimit, now) {
+		return "", apierror.TenantRateLimited
+	}
+
+	return name, nil
+}
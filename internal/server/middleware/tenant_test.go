@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-metricscol/internal/auth"
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/tenant"
+)
+
+func TestHTTPTenantHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		agent      *auth.Agent
+		header     string
+		fromHeader bool
+		statusCode int
+		tenant     string
+	}{
+		{
+			name:       "Default tenant",
+			statusCode: http.StatusOK,
+			tenant:     tenant.Default,
+		},
+		{
+			name:       "Tenant from header",
+			header:     "team-a",
+			fromHeader: true,
+			statusCode: http.StatusOK,
+			tenant:     "team-a",
+		},
+		{
+			name:       "Tenant from header isn't allowed",
+			header:     "team-a",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Default tenant from header",
+			header:     tenant.Default,
+			statusCode: http.StatusOK,
+			tenant:     tenant.Default,
+		},
+		{
+			name:       "Token without tenant",
+			agent:      &auth.Agent{Name: "agent-1"},
+			header:     "team-a",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Token without tenant and tenant from header",
+			agent:      &auth.Agent{Name: "agent-1"},
+			header:     "team-a",
+			fromHeader: true,
+			statusCode: http.StatusOK,
+			tenant:     "team-a",
+		},
+		{
+			name:       "Tenant from token",
+			agent:      &auth.Agent{Name: "agent-1", Tenant: "team-b"},
+			statusCode: http.StatusOK,
+			tenant:     "team-b",
+		},
+		{
+			name:       "Header doesn't match token",
+			agent:      &auth.Agent{Name: "agent-1", Tenant: "team-b"},
+			header:     "team-a",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Invalid tenant",
+			header:     "team/a",
+			fromHeader: true,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			require.NoError(t, err)
+			if len(tt.header) != 0 {
+				req.Header.Set(tenant.Header, tt.header)
+			}
+			if tt.agent != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), *tt.agent))
+			}
+
+			var name string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				name = tenant.FromContext(r.Context())
+			})
+
+			rr := httptest.NewRecorder()
+			mw := NewManager(nil, nil, &config.ServerConfig{TenantFromHeader: tt.fromHeader}, nil)
+			mw.HTTPTenantHandler(handler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, tt.tenant, name)
+		})
+	}
+}
+
+func TestGrpcTenantHandler_RateLimit(t *testing.T) {
+	cfg := &config.ServerConfig{
+		TenantFromHeader: true,
+		TenantQuota:      config.TenantQuota{RateLimit: 1},
+		TenantQuotas:     map[string]config.TenantQuota{"team-b": {}},
+	}
+	mw := NewManager(nil, nil, cfg, nil)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return tenant.FromContext(ctx), nil
+	}
+
+	call := func(name string) (interface{}, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, name))
+		return mw.GrpcTenantHandler(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	}
+
+	resp, err := call("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", resp)
+
+	_, err = call("team-a")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// team-b has its own quota without rate limit.
+	for i := 0; i < 3; i++ {
+		_, err = call("team-b")
+		assert.NoError(t, err)
+	}
+}
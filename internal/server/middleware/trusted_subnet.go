@@ -14,8 +14,21 @@ import (
 	"go-metricscol/internal/server/apierror"
 )
 
+// HTTPTrustedSubnetHandler checks that the client is in trusted subnet.
+// If the client is verified with TLS certificate, addresses of its ClientIdentity are checked instead of X-Real-IP.
 func (mw *Manager) HTTPTrustedSubnetHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity, ok := ClientIdentityFromContext(r.Context()); ok {
+			if err := trustedSubnetIdentityHandler(mw.cfg, identity); err != nil {
+				apierror.WriteHTTP(w, err)
+				return
+			}
+
+			r.Header.Del("X-Real-IP")
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		headerValue := r.Header.Get("X-Real-IP")
 
 		if err := trustedSubnetHandler(mw.cfg, headerValue); err != nil {
@@ -29,7 +42,17 @@ func (mw *Manager) HTTPTrustedSubnetHandler(next http.Handler) http.Handler {
 	})
 }
 
+// GrpcTrustedSubnetHandler checks that the client is in trusted subnet.
+// If the client is verified with TLS certificate, addresses of its ClientIdentity are checked instead of X-Real-IP.
 func (mw *Manager) GrpcTrustedSubnetHandler(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if identity, ok := ClientIdentityFromContext(ctx); ok {
+		if err := trustedSubnetIdentityHandler(mw.cfg, identity); err != nil {
+			return nil, apierror.GRPCStatus(err)
+		}
+
+		return handler(ctx, req)
+	}
+
 	var headerValue string
 
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
@@ -42,7 +65,7 @@ func (mw *Manager) GrpcTrustedSubnetHandler(ctx context.Context, req interface{}
 	}
 
 	if err := trustedSubnetHandler(mw.cfg, headerValue); err != nil {
-		return nil, status.Errorf(codes.PermissionDenied, err.Message)
+		return nil, apierror.GRPCStatus(err)
 	}
 
 	return handler(ctx, req)
@@ -52,17 +75,41 @@ func trustedSubnetHandler(cfg *config.ServerConfig, headerValue string) *apierro
 	if len(headerValue) != 0 && len(cfg.TrustedSubnet) != 0 {
 		ip := net.ParseIP(headerValue)
 		if ip == nil {
-			return apierror.NewAPIError(http.StatusBadRequest, "Couldn't parse IP from header X-Real-IP")
+			return apierror.NewAPIError(http.StatusBadRequest, "invalid_real_ip", "Couldn't parse IP from header X-Real-IP")
 		}
 
 		_, ipNet, err := net.ParseCIDR(cfg.TrustedSubnet)
 		if err != nil {
-			return apierror.NewAPIError(http.StatusInternalServerError, "Couldn't parse CIDR")
+			return apierror.NewAPIError(http.StatusInternalServerError, "invalid_trusted_subnet", "Couldn't parse CIDR")
 		}
 
 		if !ipNet.Contains(ip) {
-			return apierror.NewAPIError(http.StatusForbidden, "X-Real-IP is not in trusted subnet")
+			return apierror.NewAPIError(http.StatusForbidden, "not_in_trusted_subnet", "X-Real-IP is not in trusted subnet")
 		}
 	}
 	return nil
 }
+
+// trustedSubnetIdentityHandler checks that all addresses of verified client are in trusted subnet.
+func trustedSubnetIdentityHandler(cfg *config.ServerConfig, identity ClientIdentity) *apierror.APIError {
+	if len(cfg.TrustedSubnet) == 0 {
+		return nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(cfg.TrustedSubnet)
+	if err != nil {
+		return apierror.NewAPIError(http.StatusInternalServerError, "invalid_trusted_subnet", "Couldn't parse CIDR")
+	}
+
+	if len(identity.IPs) == 0 {
+		return apierror.NewAPIError(http.StatusForbidden, "not_in_trusted_subnet", "Client certificate has no IP address")
+	}
+
+	for _, ip := range identity.IPs {
+		if !ipNet.Contains(ip) {
+			return apierror.NewAPIError(http.StatusForbidden, "not_in_trusted_subnet", "Client certificate is not in trusted subnet")
+		}
+	}
+
+	return nil
+}
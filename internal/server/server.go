@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -15,19 +16,20 @@ import (
 )
 
 // Server defines config and repository for HTTPType server instance.
+// Server may host several backends, which share repository, disk saver and lifecycle.
 type Server struct {
-	Config  *config.ServerConfig
-	Repo    repository.Repository
-	Backend backends.Backend
+	Config   *config.ServerConfig
+	Repo     repository.Repository
+	Backends []backends.Backend
 }
 
 // NewServer returns new Server with defined config.
-func NewServer(config *config.ServerConfig, repo repository.Repository, backendType backends.Backend) *Server {
-	return &Server{Config: config, Repo: repo, Backend: backendType}
+func NewServer(config *config.ServerConfig, repo repository.Repository, backends ...backends.Backend) *Server {
+	return &Server{Config: config, Repo: repo, Backends: backends}
 }
 
-// ListenAndServe listens on the TCP network address given in config and then calls Serve to handle requests on incoming connections.
-// Accepted connections are configured to enable TCP keep-alives.
+// ListenAndServe starts every backend and blocks until ctx is done or any backend fails.
+// Then all backends are gracefully shut down and metrics are saved to disk.
 func (s Server) ListenAndServe(ctx context.Context) error {
 	if s.Config.Restore {
 		if err := s.Repo.RestoreFromDisk(s.Config.StoreFile); err != nil {
@@ -37,13 +39,13 @@ func (s Server) ListenAndServe(ctx context.Context) error {
 		}
 	}
 
-	group, _ := errgroup.WithContext(context.Background())
+	group, groupCtx := errgroup.WithContext(context.Background())
 
 	shutdownWg := sync.WaitGroup{}
 	diskContext, cancel := context.WithCancel(context.Background())
 	if len(s.Config.StoreFile) != 0 && s.Config.StoreInterval != 0 && len(s.Config.DatabaseDSN) == 0 {
+		shutdownWg.Add(1)
 		group.Go(func() error {
-			shutdownWg.Add(1)
 			defer shutdownWg.Done()
 
 			err := s.enableSavingToDisk(diskContext)
@@ -54,16 +56,38 @@ func (s Server) ListenAndServe(ctx context.Context) error {
 		})
 	}
 
-	group.Go(func() error {
-		if err := s.Backend.ListenAndServe(); err != nil {
-			return err
-		}
+	if len(s.Config.Retention) != 0 && s.Config.CompactInterval != 0 {
+		shutdownWg.Add(1)
+		group.Go(func() error {
+			defer shutdownWg.Done()
 
-		return nil
-	})
+			s.enableCompaction(diskContext)
+			return nil
+		})
+	}
+
+	for _, backend := range s.Backends {
+		backend := backend
+		group.Go(func() error {
+			if err := backend.ListenAndServe(); err != nil {
+				return err
+			}
 
-	<-ctx.Done()
-	err := s.Backend.GracefulShutdown(context.Background())
+			return nil
+		})
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-groupCtx.Done():
+	}
+
+	var shutdownErrs []error
+	for _, backend := range s.Backends {
+		if err := backend.GracefulShutdown(context.Background()); err != nil {
+			shutdownErrs = append(shutdownErrs, err)
+		}
+	}
 	cancel()
 
 	shutdownWg.Wait()
@@ -71,5 +95,5 @@ func (s Server) ListenAndServe(ctx context.Context) error {
 		return err
 	}
 
-	return err
+	return errors.Join(shutdownErrs...)
 }
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-metricscol/internal/config"
+	"go-metricscol/internal/models"
+	"go-metricscol/internal/repository/memory"
+)
+
+// fakeBackend serves until it is shut down or fails with err after start.
+type fakeBackend struct {
+	err      error
+	started  chan struct{}
+	shutdown chan struct{}
+}
+
+func newFakeBackend(err error) *fakeBackend {
+	return &fakeBackend{err: err, started: make(chan struct{}), shutdown: make(chan struct{})}
+}
+
+func (f *fakeBackend) ListenAndServe() error {
+	close(f.started)
+	if f.err != nil {
+		return f.err
+	}
+
+	<-f.shutdown
+	return nil
+}
+
+func (f *fakeBackend) GracefulShutdown(_ context.Context) error {
+	select {
+	case <-f.shutdown:
+	default:
+		close(f.shutdown)
+	}
+	return nil
+}
+
+func TestServer_ListenAndServeMultipleBackends(t *testing.T) {
+	cfg, err := config.NewServerConfig("", models.Duration{}, "", false, "", "", "", "")
+	require.NoError(t, err)
+
+	t.Run("Shutdown on context cancel", func(t *testing.T) {
+		first, second := newFakeBackend(nil), newFakeBackend(nil)
+		server := NewServer(cfg, memory.NewMemStorage(), first, second)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+		go func() {
+			result <- server.ListenAndServe(ctx)
+		}()
+
+		<-first.started
+		<-second.started
+		cancel()
+
+		select {
+		case err := <-result:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("server wasn't shut down")
+		}
+	})
+
+	t.Run("Failed backend shuts down others", func(t *testing.T) {
+		backendErr := errors.New("couldn't listen")
+		failed, healthy := newFakeBackend(backendErr), newFakeBackend(nil)
+		server := NewServer(cfg, memory.NewMemStorage(), healthy, failed)
+
+		result := make(chan error)
+		go func() {
+			result <- server.ListenAndServe(context.Background())
+		}()
+
+		select {
+		case err := <-result:
+			assert.ErrorIs(t, err, backendErr)
+		case <-time.After(time.Second):
+			t.Fatal("server wasn't shut down")
+		}
+
+		<-healthy.shutdown
+	})
+}
@@ -0,0 +1,47 @@
+// Package tenant identifies teams sharing one collector, metrics of every tenant are stored in a separate namespace.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+const (
+	// Default is tenant of requests which don't specify it.
+	Default = "default"
+	// Header is HTTP header with tenant name.
+	Header = "X-Tenant"
+	// MetadataKey is grpc metadata key with tenant name.
+	MetadataKey = "x-tenant"
+)
+
+// ErrInvalid is returned if tenant name is not valid.
+var ErrInvalid = errors.New("invalid tenant name")
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// Validate returns ErrInvalid if name is not 1-64 letters, digits, '_', '.' or '-'.
+func Validate(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+type tenantKey struct{}
+
+// NewContext returns context which stores tenant name.
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext returns tenant name stored in context or Default if there is no tenant.
+func FromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(tenantKey{}).(string); ok {
+		return name
+	}
+
+	return Default
+}